@@ -0,0 +1,50 @@
+// Package analytics 基于采集到的座位占用快照生成统计报表
+package analytics
+
+import (
+	"context"
+	"time"
+
+	libraryreservation "github.com/chencheng8888/ccnu-library-reservations"
+)
+
+type (
+	Record = libraryreservation.OccupancyRecord
+	Period = libraryreservation.Period
+)
+
+// Load 读取 store 中的全部快照
+func Load(ctx context.Context, store libraryreservation.OccupancyStore) ([]Record, error) {
+	var records []Record
+	err := store.Scan(ctx, func(rec Record) error {
+		records = append(records, rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// FilterRoom 只保留 roomID 的记录，roomID 为空时返回全部
+func FilterRoom(records []Record, roomID string) []Record {
+	if roomID == "" {
+		return records
+	}
+	var res []Record
+	for _, rec := range records {
+		if rec.RoomID == roomID {
+			res = append(res, rec)
+		}
+	}
+	return res
+}
+
+// occupiedWithin 计算 [start, end) 内被占用的时长
+func occupiedWithin(occupied []Period, start, end time.Time) time.Duration {
+	return libraryreservation.TotalDuration(libraryreservation.IntersectAll(occupied, []Period{{StartTime: start, EndTime: end}}))
+}
+
+func dayOf(t time.Time) string {
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,132 @@
+package analytics
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+func at(day, hour, min int) time.Time {
+	return pkg.CreateShanghaiTime(2025, 6, day, hour, min)
+}
+
+func record(snapshot time.Time, seatID string, start, end time.Time, occupied ...Period) Record {
+	return Record{
+		At:          snapshot,
+		RoomID:      "room",
+		SeatID:      seatID,
+		SeatName:    "N1-" + seatID,
+		WindowStart: start,
+		WindowEnd:   end,
+		Free:        len(occupied) == 0,
+		Occupied:    occupied,
+	}
+}
+
+func TestOccupancyHeatmap(t *testing.T) {
+	// 2025-06-02 是星期一
+	start, end := at(2, 8, 0), at(2, 10, 0)
+	records := []Record{
+		record(at(1, 20, 0), "1", start, end),
+		// 更晚的快照覆盖了更早的
+		record(at(2, 7, 0), "1", start, end, Period{StartTime: at(2, 8, 0), EndTime: at(2, 8, 30)}),
+		record(at(2, 7, 0), "2", start, end, Period{StartTime: at(2, 8, 0), EndTime: at(2, 10, 0)}),
+	}
+
+	heatmap := OccupancyHeatmap(records)
+	if len(heatmap) != 2 {
+		t.Fatalf("expected 2 cells, got %+v", heatmap)
+	}
+	if c := heatmap[0]; c.Weekday != time.Monday || c.Hour != 8 || c.Occupancy != 0.75 || c.Samples != 2 {
+		t.Errorf("unexpected 8 o'clock cell %+v", c)
+	}
+	if c := heatmap[1]; c.Hour != 9 || c.Occupancy != 0.5 {
+		t.Errorf("unexpected 9 o'clock cell %+v", c)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportCSV(&buf, heatmap); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "room_id,weekday,hour,occupancy,samples\nroom,Monday,8,0.7500,2\n") {
+		t.Errorf("unexpected csv %q", buf.String())
+	}
+}
+
+func TestFillUpTimes(t *testing.T) {
+	start, end := at(2, 8, 0), at(2, 22, 0)
+	full := Period{StartTime: start, EndTime: end}
+	records := []Record{
+		record(at(1, 17, 0), "1", start, end),
+		record(at(1, 18, 10), "1", start, end),
+		record(at(1, 18, 25), "1", start, end, full),
+		record(at(1, 18, 40), "1", start, end, full),
+	}
+	stats := FillUpTimes(records, func(day time.Time) time.Time {
+		return day.Add(-14 * time.Hour) // 前一天 18:00 开放预约
+	})
+	if len(stats) != 1 || !stats[0].Filled || stats[0].Minutes != 25 {
+		t.Errorf("unexpected fill up stats %+v", stats)
+	}
+}
+
+func TestMostContestedAndCancellation(t *testing.T) {
+	start, end := at(2, 8, 0), at(2, 12, 0)
+	booking := Period{Owner: "a", StartTime: at(2, 9, 0), EndTime: at(2, 11, 0)}
+	other := Period{Owner: "b", StartTime: at(2, 8, 0), EndTime: at(2, 12, 0)}
+	records := []Record{
+		record(at(1, 20, 0), "1", start, end, booking),
+		record(at(1, 20, 0), "2", start, end, other),
+		record(at(1, 21, 0), "1", start, end),
+		record(at(1, 21, 0), "2", start, end, other),
+	}
+
+	contested := MostContested(records, 1)
+	if len(contested) != 1 || contested[0].SeatID != "2" || contested[0].OccupiedRate != 1 {
+		t.Errorf("unexpected most contested %+v", contested)
+	}
+
+	rates := CancellationRates(records)
+	if len(rates) != 1 || rates[0].Bookings != 2 || rates[0].Cancelled != 1 || rates[0].Rate != 0.5 {
+		t.Errorf("unexpected cancellation rates %+v", rates)
+	}
+}
+
+func TestPredict(t *testing.T) {
+	// 2025-06-02 和 2025-06-09 是星期一，2025-06-10 是星期二
+	var records []Record
+	for _, day := range []int{2, 9, 10} {
+		start, end := at(day, 8, 0), at(day, 22, 0)
+		snapshot := at(day, 7, 0)
+		records = append(records, record(snapshot, "2", start, end, Period{StartTime: start, EndTime: end}))
+		if day == 9 {
+			records = append(records, record(snapshot, "1", start, end))
+		} else {
+			records = append(records, record(snapshot, "1", start, end, Period{StartTime: at(day, 15, 0), EndTime: at(day, 16, 0)}))
+		}
+	}
+
+	p := NewPredictor(records, WithHalfLife(7*24*time.Hour))
+	pred, err := p.Predict("room", at(16, 14, 0), at(16, 18, 0))
+	if err != nil {
+		t.Fatalf("predict failed: %v", err)
+	}
+	if pred.Days != 2 {
+		t.Fatalf("expected 2 Mondays in history, got %d", pred.Days)
+	}
+	// 06-09 权重 0.5，06-02 权重 0.25
+	if want := 0.5 / 0.75; math.Abs(pred.Probability-want) > 1e-9 || math.Abs(pred.Seats["1"]-want) > 1e-9 {
+		t.Errorf("unexpected probability %v, seats %v", pred.Probability, pred.Seats)
+	}
+	if pred.Seats["2"] != 0 {
+		t.Errorf("seat 2 is never free, got %v", pred.Seats["2"])
+	}
+
+	if _, err := p.Predict("other", at(16, 14, 0), at(16, 18, 0)); err == nil {
+		t.Errorf("expected error for room without history")
+	}
+}
@@ -0,0 +1,94 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Table 可以导出为 CSV 的报表
+type Table interface {
+	Header() []string
+	Rows() [][]string
+}
+
+// ExportCSV 把报表写成带表头的 CSV
+func ExportCSV(w io.Writer, t Table) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.Header()); err != nil {
+		return fmt.Errorf("failed to write csv header: %w", err)
+	}
+	if err := cw.WriteAll(t.Rows()); err != nil {
+		return fmt.Errorf("failed to write csv rows: %w", err)
+	}
+	return nil
+}
+
+// ExportJSON 把报表写成带缩进的 JSON
+func ExportJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode json: %w", err)
+	}
+	return nil
+}
+
+func (h Heatmap) Header() []string {
+	return []string{"room_id", "weekday", "hour", "occupancy", "samples"}
+}
+
+func (h Heatmap) Rows() [][]string {
+	rows := make([][]string, 0, len(h))
+	for _, c := range h {
+		rows = append(rows, []string{c.RoomID, c.Weekday.String(), strconv.Itoa(c.Hour), formatFloat(c.Occupancy), strconv.Itoa(c.Samples)})
+	}
+	return rows
+}
+
+func (f FillUps) Header() []string {
+	return []string{"room_id", "day", "opens_at", "full_at", "minutes", "filled"}
+}
+
+func (f FillUps) Rows() [][]string {
+	rows := make([][]string, 0, len(f))
+	for _, s := range f {
+		fullAt := ""
+		if s.Filled {
+			fullAt = s.FullAt.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{s.RoomID, s.Day, s.OpensAt.Format(time.RFC3339), fullAt, formatFloat(s.Minutes), strconv.FormatBool(s.Filled)})
+	}
+	return rows
+}
+
+func (c Contentions) Header() []string {
+	return []string{"room_id", "seat_id", "seat_name", "snapshots", "occupied_rate", "distinct_owners"}
+}
+
+func (c Contentions) Rows() [][]string {
+	rows := make([][]string, 0, len(c))
+	for _, s := range c {
+		rows = append(rows, []string{s.RoomID, s.SeatID, s.SeatName, strconv.Itoa(s.Snapshots), formatFloat(s.OccupiedRate), strconv.Itoa(s.DistinctOwners)})
+	}
+	return rows
+}
+
+func (c Cancellations) Header() []string {
+	return []string{"room_id", "bookings", "cancelled", "rate"}
+}
+
+func (c Cancellations) Rows() [][]string {
+	rows := make([][]string, 0, len(c))
+	for _, s := range c {
+		rows = append(rows, []string{s.RoomID, strconv.Itoa(s.Bookings), strconv.Itoa(s.Cancelled), formatFloat(s.Rate)})
+	}
+	return rows
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
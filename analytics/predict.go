@@ -0,0 +1,172 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Prediction 某个区域在某个时间段内有空闲座位的概率
+type Prediction struct {
+	RoomID    string    `json:"roomId"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	// Probability 至少有一个座位整段空闲的概率
+	Probability float64 `json:"probability"`
+	// Seats 每个座位整段空闲的概率，SeatID -> 概率
+	Seats map[string]float64 `json:"seats"`
+	// Days 参与统计的历史天数
+	Days int `json:"days"`
+}
+
+type PredictOption func(*Predictor)
+
+// WithHalfLife 设置历史数据的半衰期，越久远的数据权重越低，默认 14 天
+func WithHalfLife(d time.Duration) PredictOption {
+	return func(p *Predictor) {
+		if d > 0 {
+			p.halfLife = d
+		}
+	}
+}
+
+// Predictor 基于历史快照的经验频率估计座位空闲概率，近期的数据权重更高
+type Predictor struct {
+	halfLife time.Duration
+	// roomID -> 日期 -> 当天的快照记录
+	history map[string]map[string][]Record
+}
+
+func NewPredictor(records []Record, opts ...PredictOption) *Predictor {
+	p := &Predictor{
+		halfLife: 14 * 24 * time.Hour,
+		history:  make(map[string]map[string][]Record),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	for _, rec := range records {
+		days := p.history[rec.RoomID]
+		if days == nil {
+			days = make(map[string][]Record)
+			p.history[rec.RoomID] = days
+		}
+		day := dayOf(rec.WindowStart)
+		days[day] = append(days[day], rec)
+	}
+	return p
+}
+
+// Predict 估计 roomID 在 [startTime, endTime] 内有整段空闲座位的概率。
+// 优先使用星期几相同的历史数据，没有时使用全部历史数据。
+// 每个历史日期只使用在对应时间段开始之前最后一次采集的快照，与实际查询时能看到的情况一致
+func (p *Predictor) Predict(roomID string, startTime, endTime time.Time) (Prediction, error) {
+	if !startTime.Before(endTime) {
+		return Prediction{}, fmt.Errorf("invalid time range: %v - %v", startTime, endTime)
+	}
+
+	pred, ok := p.predict(roomID, startTime, endTime, true)
+	if !ok {
+		pred, ok = p.predict(roomID, startTime, endTime, false)
+	}
+	if !ok {
+		return Prediction{}, fmt.Errorf("no history for room %s covering %s-%s", roomID, startTime.Format("15:04"), endTime.Format("15:04"))
+	}
+	return pred, nil
+}
+
+func (p *Predictor) predict(roomID string, startTime, endTime time.Time, sameWeekday bool) (Prediction, bool) {
+	pred := Prediction{
+		RoomID:    roomID,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Seats:     make(map[string]float64),
+	}
+
+	var (
+		roomWeight, roomFree float64
+		seatWeight           = make(map[string]float64)
+	)
+
+	days := make([]string, 0, len(p.history[roomID]))
+	for day := range p.history[roomID] {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	for _, day := range days {
+		records := p.history[roomID][day]
+		ws, we := sameClockOn(records[0].WindowStart, startTime), sameClockOn(records[0].WindowStart, endTime)
+		if sameWeekday && ws.Weekday() != startTime.Weekday() {
+			continue
+		}
+		if !ws.Before(startTime) {
+			// 只使用过去的数据
+			continue
+		}
+
+		free, observed := seatsFreeOn(records, ws, we)
+		if len(observed) == 0 {
+			continue
+		}
+
+		weight := p.weight(startTime.Sub(ws))
+		pred.Days++
+		roomWeight += weight
+		anyFree := false
+		for seatID := range observed {
+			seatWeight[seatID] += weight
+			if free[seatID] {
+				pred.Seats[seatID] += weight
+				anyFree = true
+			}
+		}
+		if anyFree {
+			roomFree += weight
+		}
+	}
+
+	if pred.Days == 0 {
+		return Prediction{}, false
+	}
+	pred.Probability = roomFree / roomWeight
+	for seatID, w := range seatWeight {
+		pred.Seats[seatID] /= w
+	}
+	return pred, true
+}
+
+// seatsFreeOn 对每个座位取 ws 之前最后一次完整覆盖 [ws, we] 的快照，判断是否整段空闲
+func seatsFreeOn(records []Record, ws, we time.Time) (map[string]bool, map[string]bool) {
+	latest := make(map[string]Record)
+	for _, rec := range records {
+		if rec.At.After(ws) || rec.WindowStart.After(ws) || rec.WindowEnd.Before(we) {
+			continue
+		}
+		if old, ok := latest[rec.SeatID]; !ok || rec.At.After(old.At) {
+			latest[rec.SeatID] = rec
+		}
+	}
+
+	free := make(map[string]bool, len(latest))
+	observed := make(map[string]bool, len(latest))
+	for seatID, rec := range latest {
+		observed[seatID] = true
+		free[seatID] = occupiedWithin(rec.Occupied, ws, we) == 0
+	}
+	return free, observed
+}
+
+func (p *Predictor) weight(age time.Duration) float64 {
+	if age < 0 {
+		age = -age
+	}
+	return math.Pow(0.5, float64(age)/float64(p.halfLife))
+}
+
+// sameClockOn 返回 day 那一天与 clock 时分相同的时间
+func sameClockOn(day, clock time.Time) time.Time {
+	clock = clock.In(day.Location())
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, day.Location())
+}
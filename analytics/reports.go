@@ -0,0 +1,304 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+)
+
+// HeatmapCell 某个区域在星期几、几点的平均占用率
+type HeatmapCell struct {
+	RoomID    string       `json:"roomId"`
+	Weekday   time.Weekday `json:"weekday"`
+	Hour      int          `json:"hour"`
+	Occupancy float64      `json:"occupancy"` // 0~1
+	Samples   int          `json:"samples"`   // 参与统计的座位小时数
+}
+
+type Heatmap []HeatmapCell
+
+// OccupancyHeatmap 统计每个区域按星期、小时的占用率。
+// 对每个座位的每个小时，只使用完整覆盖该小时且最晚采集的快照
+func OccupancyHeatmap(records []Record) Heatmap {
+	type slotKey struct {
+		roomID, seatID string
+		hour           int64 // 小时开始时间的 Unix 秒
+	}
+	latest := make(map[slotKey]*Record)
+
+	for i := range records {
+		rec := &records[i]
+		for slot := ceilHour(rec.WindowStart); !slot.Add(time.Hour).After(rec.WindowEnd); slot = slot.Add(time.Hour) {
+			key := slotKey{rec.RoomID, rec.SeatID, slot.Unix()}
+			if old, ok := latest[key]; !ok || rec.At.After(old.At) {
+				latest[key] = rec
+			}
+		}
+	}
+
+	type cellKey struct {
+		roomID  string
+		weekday time.Weekday
+		hour    int
+	}
+	sums := make(map[cellKey]float64)
+	counts := make(map[cellKey]int)
+	for key, rec := range latest {
+		slot := time.Unix(key.hour, 0).In(rec.WindowStart.Location())
+		occupied := occupiedWithin(rec.Occupied, slot, slot.Add(time.Hour))
+		ck := cellKey{key.roomID, slot.Weekday(), slot.Hour()}
+		sums[ck] += float64(occupied) / float64(time.Hour)
+		counts[ck]++
+	}
+
+	heatmap := make(Heatmap, 0, len(sums))
+	for ck, sum := range sums {
+		heatmap = append(heatmap, HeatmapCell{
+			RoomID:    ck.roomID,
+			Weekday:   ck.weekday,
+			Hour:      ck.hour,
+			Occupancy: sum / float64(counts[ck]),
+			Samples:   counts[ck],
+		})
+	}
+	sort.Slice(heatmap, func(i, j int) bool {
+		a, b := heatmap[i], heatmap[j]
+		if a.RoomID != b.RoomID {
+			return a.RoomID < b.RoomID
+		}
+		if a.Weekday != b.Weekday {
+			return a.Weekday < b.Weekday
+		}
+		return a.Hour < b.Hour
+	})
+	return heatmap
+}
+
+// FillUpStat 某个区域某一天从开放预约到没有整段空闲座位所用的时间
+type FillUpStat struct {
+	RoomID  string    `json:"roomId"`
+	Day     string    `json:"day"`
+	OpensAt time.Time `json:"opensAt"`
+	FullAt  time.Time `json:"fullAt,omitzero"`
+	Minutes float64   `json:"minutes"` // Filled 为 false 时无意义
+	Filled  bool      `json:"filled"`  // 观察期内是否约满
+}
+
+type FillUps []FillUpStat
+
+// FillUpTimes 统计每个区域每一天在开放预约后多少分钟约满，
+// opensAt 返回某一天的座位开始开放预约的时间
+func FillUpTimes(records []Record, opensAt func(day time.Time) time.Time) FillUps {
+	type dayKey struct {
+		roomID, day string
+	}
+	type snapshot struct {
+		at  time.Time
+		any bool // 是否还有整段空闲的座位
+	}
+	snaps := make(map[dayKey]map[int64]*snapshot)
+	firstDay := make(map[dayKey]time.Time)
+
+	for _, rec := range records {
+		key := dayKey{rec.RoomID, dayOf(rec.WindowStart)}
+		if snaps[key] == nil {
+			snaps[key] = make(map[int64]*snapshot)
+			firstDay[key] = rec.WindowStart
+		}
+		s := snaps[key][rec.At.Unix()]
+		if s == nil {
+			s = &snapshot{at: rec.At}
+			snaps[key][rec.At.Unix()] = s
+		}
+		s.any = s.any || rec.Free
+	}
+
+	var stats FillUps
+	for key, byAt := range snaps {
+		ordered := make([]*snapshot, 0, len(byAt))
+		for _, s := range byAt {
+			ordered = append(ordered, s)
+		}
+		sort.Slice(ordered, func(i, j int) bool { return ordered[i].at.Before(ordered[j].at) })
+
+		open := opensAt(firstDay[key])
+		stat := FillUpStat{RoomID: key.roomID, Day: key.day, OpensAt: open}
+		for _, s := range ordered {
+			if s.at.Before(open) || s.any {
+				continue
+			}
+			stat.Filled = true
+			stat.FullAt = s.at
+			stat.Minutes = s.at.Sub(open).Minutes()
+			break
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].RoomID != stats[j].RoomID {
+			return stats[i].RoomID < stats[j].RoomID
+		}
+		return stats[i].Day < stats[j].Day
+	})
+	return stats
+}
+
+// SeatContention 座位的抢手程度
+type SeatContention struct {
+	RoomID         string  `json:"roomId"`
+	SeatID         string  `json:"seatId"`
+	SeatName       string  `json:"seatName"`
+	Snapshots      int     `json:"snapshots"`
+	OccupiedRate   float64 `json:"occupiedRate"`   // 查询时间段内被占用时长的平均占比
+	DistinctOwners int     `json:"distinctOwners"` // 不同占用者的数量
+}
+
+type Contentions []SeatContention
+
+// MostContested 返回占用率最高的 n 个座位，n <= 0 时返回全部
+func MostContested(records []Record, n int) Contentions {
+	type acc struct {
+		SeatContention
+		rateSum float64
+		owners  map[string]bool
+	}
+	seats := make(map[string]*acc)
+	for _, rec := range records {
+		key := rec.RoomID + "/" + rec.SeatID
+		a := seats[key]
+		if a == nil {
+			a = &acc{
+				SeatContention: SeatContention{RoomID: rec.RoomID, SeatID: rec.SeatID, SeatName: rec.SeatName},
+				owners:         make(map[string]bool),
+			}
+			seats[key] = a
+		}
+		window := rec.WindowEnd.Sub(rec.WindowStart)
+		if window <= 0 {
+			continue
+		}
+		a.Snapshots++
+		a.rateSum += float64(occupiedWithin(rec.Occupied, rec.WindowStart, rec.WindowEnd)) / float64(window)
+		for _, p := range rec.Occupied {
+			if p.Owner != "" {
+				a.owners[p.Owner] = true
+			}
+		}
+	}
+
+	res := make(Contentions, 0, len(seats))
+	for _, a := range seats {
+		if a.Snapshots == 0 {
+			continue
+		}
+		a.OccupiedRate = a.rateSum / float64(a.Snapshots)
+		a.DistinctOwners = len(a.owners)
+		res = append(res, a.SeatContention)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].OccupiedRate != res[j].OccupiedRate {
+			return res[i].OccupiedRate > res[j].OccupiedRate
+		}
+		if res[i].DistinctOwners != res[j].DistinctOwners {
+			return res[i].DistinctOwners > res[j].DistinctOwners
+		}
+		return res[i].SeatID < res[j].SeatID
+	})
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// CancellationStat 区域内预约被取消的比例
+type CancellationStat struct {
+	RoomID    string  `json:"roomId"`
+	Bookings  int     `json:"bookings"`  // 观察到的预约数量
+	Cancelled int     `json:"cancelled"` // 在开始之前消失的预约数量
+	Rate      float64 `json:"rate"`
+}
+
+type Cancellations []CancellationStat
+
+// CancellationRates 统计每个区域的取消率：一条预约在之前的快照中出现，
+// 但在它开始之前、覆盖它的快照中消失，则视为被取消
+func CancellationRates(records []Record) Cancellations {
+	sorted := make([]Record, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].At.Before(sorted[j].At) })
+
+	// 开始时间可能被查询时间段截断，因此用结束时间识别同一条预约
+	type bookingKey struct {
+		roomID, seatID, owner string
+		end                   int64
+	}
+	type booking struct {
+		start     time.Time
+		cancelled bool
+	}
+	// 按座位和结束时间所在的天（UTC）索引预约，每条快照只需要检查同一座位、窗口覆盖的几天内的预约
+	type seatDay struct {
+		roomID, seatID string
+		day            int64
+	}
+	const secondsPerDay = 24 * 60 * 60
+	bookings := make(map[bookingKey]*booking)
+	index := make(map[seatDay][]bookingKey)
+
+	for _, rec := range sorted {
+		present := make(map[bookingKey]bool, len(rec.Occupied))
+		for _, p := range rec.Occupied {
+			key := bookingKey{rec.RoomID, rec.SeatID, p.Owner, p.EndTime.Unix()}
+			present[key] = true
+			b := bookings[key]
+			if b == nil {
+				bookings[key] = &booking{start: p.StartTime}
+				day := seatDay{rec.RoomID, rec.SeatID, key.end / secondsPerDay}
+				index[day] = append(index[day], key)
+				continue
+			}
+			// 之前判定为取消但又出现了，说明只是数据抖动
+			b.cancelled = false
+		}
+
+		for day := rec.WindowStart.Unix() / secondsPerDay; day <= rec.WindowEnd.Unix()/secondsPerDay; day++ {
+			for _, key := range index[seatDay{rec.RoomID, rec.SeatID, day}] {
+				if present[key] {
+					continue
+				}
+				b, end := bookings[key], time.Unix(key.end, 0)
+				if rec.At.Before(b.start) && rec.WindowStart.Before(end) && !end.After(rec.WindowEnd) {
+					b.cancelled = true
+				}
+			}
+		}
+	}
+
+	byRoom := make(map[string]*CancellationStat)
+	for key, b := range bookings {
+		stat := byRoom[key.roomID]
+		if stat == nil {
+			stat = &CancellationStat{RoomID: key.roomID}
+			byRoom[key.roomID] = stat
+		}
+		stat.Bookings++
+		if b.cancelled {
+			stat.Cancelled++
+		}
+	}
+
+	res := make(Cancellations, 0, len(byRoom))
+	for _, stat := range byRoom {
+		stat.Rate = float64(stat.Cancelled) / float64(stat.Bookings)
+		res = append(res, *stat)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].RoomID < res[j].RoomID })
+	return res
+}
+
+func ceilHour(t time.Time) time.Time {
+	h := t.Truncate(time.Hour)
+	if h.Before(t) {
+		h = h.Add(time.Hour)
+	}
+	return h
+}
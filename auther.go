@@ -3,7 +3,10 @@ package library_reservation
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
@@ -24,23 +27,51 @@ type Auther interface {
 	GetCookie(ctx context.Context, stuID string) (string, error)
 }
 
-type cookieRes struct {
-	cookie    string
-	createdAt time.Time
+// SessionStore 可以保存在浏览器中登录得到的会话的 Auther，用于不愿提供密码的学生。
+// NewAuther 返回的 Auther 实现了该接口
+type SessionStore interface {
+	// StoreSession 保存 ASP.NET_SessionId 的值或完整的 Cookie 请求头
+	StoreSession(ctx context.Context, stuID, cookie string) error
+	// ImportCookies 从浏览器导出的 cookies.txt 中导入 cookie
+	ImportCookies(ctx context.Context, stuID string, r io.Reader) error
 }
 
+// SessionProvider 可以返回完整登录会话的 Auther，NewAuther 返回的 Auther 实现了该接口。
+// Reverser 优先使用会话中的 cookie jar 发送请求，只实现了 Auther 时使用 GetCookie 返回的 cookie
+type SessionProvider interface {
+	// GetSession 返回学生的登录会话，其中的 cookie jar 包含登录过程中设置的所有 cookie
+	GetSession(ctx context.Context, stuID string) (*Session, error)
+	// Invalidate 图书馆系统提示未登录时调用，丢弃学生的会话，下次 GetSession 重新登录；
+	// 会话是外部提供的、无法重新登录时返回 ErrSessionExpired
+	Invalidate(ctx context.Context, stuID string) error
+}
+
+// sessionTTL 用密码登录得到的会话的缓存时间
+const sessionTTL = 5 * time.Minute
+
 type auther struct {
 	stuInfo   map[string]string // stuID -> pwd
 	infoMutex sync.RWMutex
 
-	cookies     map[string]cookieRes // stuID -> cookie
-	cookieMutex sync.RWMutex
+	sessions     map[string]*Session         // stuID -> 用密码登录得到的会话
+	external     map[string]*externalSession // stuID -> 外部提供的会话
+	sessionMutex sync.RWMutex
+
+	// 每个学生的登录锁，同一学生同时只有一次登录。登录可能要等待验证码、二次认证等人工输入，
+	// 所以不能持有 sessionMutex，否则会阻塞其他学生
+	logins     map[string]chan struct{}
+	loginMutex sync.Mutex
+
+	opts options
 }
 
-func NewAuther() Auther {
+func NewAuther(opts ...Option) Auther {
 	return &auther{
-		stuInfo: make(map[string]string),
-		cookies: make(map[string]cookieRes),
+		stuInfo:  make(map[string]string),
+		sessions: make(map[string]*Session),
+		external: make(map[string]*externalSession),
+		logins:   make(map[string]chan struct{}),
+		opts:     newOptions(opts),
 	}
 }
 
@@ -66,47 +97,139 @@ func (a *auther) StoreStuInfo(ctx context.Context, stuID string, pwd string) err
 //	return stuIDs
 //}
 
-func (a *auther) GetCookie(ctx context.Context, stuID string) (string, error) {
+func (a *auther) GetSession(ctx context.Context, stuID string) (sess *Session, err error) {
+	defer func(start time.Time) { a.opts.observe(OpGetCookie, start, err) }(time.Now())
+	ctx, span := a.opts.startSpan(ctx, SpanGetCookie, stuID)
+	defer func() { endSpan(span, err) }()
+
+	if sess, ok := a.cachedSession(stuID); ok {
+		if sess.External {
+			span.SetAttributes(Attr("session.external", true))
+		} else {
+			a.opts.metrics.IncCounter(MetricCookieCache, Labels{"result": "hit"})
+			span.SetAttributes(Attr("cache.hit", true))
+		}
+		return sess, nil
+	}
+	a.opts.metrics.IncCounter(MetricCookieCache, Labels{"result": "miss"})
+	span.SetAttributes(Attr("cache.hit", false))
 
-	a.cookieMutex.RLock()
-	if cookieRes, exists := a.cookies[stuID]; exists && time.Since(cookieRes.createdAt) < 5*time.Minute {
-		a.cookieMutex.RUnlock()
-		return cookieRes.cookie, nil
+	sess, err = a.passwordLogin(ctx, stuID)
+	if err != nil && !errors.Is(err, ErrSessionExpired) && !errors.Is(err, ErrStudentNotFound) {
+		a.opts.notify(ctx, Notification{Kind: NotifyLoginFailure, StuID: stuID, Err: err.Error()})
 	}
-	a.cookieMutex.RUnlock()
+	return sess, err
+}
 
-	a.cookieMutex.Lock()
-	defer a.cookieMutex.Unlock()
+// cachedSession 返回没有过期的外部会话或者缓存的密码登录会话
+func (a *auther) cachedSession(stuID string) (*Session, bool) {
+	a.sessionMutex.RLock()
+	defer a.sessionMutex.RUnlock()
 
-	if pwd, exists := a.stuInfo[stuID]; exists {
-		cookie, err := a.getCookie(ctx, stuID, pwd)
-		if err != nil {
-			return "", err
+	// 外部提供的会话没有过期前一直使用，不会用密码重新登录
+	if s, exists := a.external[stuID]; exists && !s.expired {
+		return s.session, true
+	}
+	if sess, exists := a.sessions[stuID]; exists && time.Since(sess.LoginAt) < sessionTTL {
+		return sess, true
+	}
+	return nil, false
+}
+
+// loginLock 返回学生的登录锁，容量为 1 的 channel 可以在等待时响应 ctx
+func (a *auther) loginLock(stuID string) chan struct{} {
+	a.loginMutex.Lock()
+	defer a.loginMutex.Unlock()
+
+	lock, ok := a.logins[stuID]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		a.logins[stuID] = lock
+	}
+	return lock
+}
+
+// passwordLogin 用密码登录并缓存会话。登录过程只持有该学生的登录锁，sessionMutex 只在保存结果时持有
+func (a *auther) passwordLogin(ctx context.Context, stuID string) (*Session, error) {
+	lock := a.loginLock(stuID)
+	select {
+	case lock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-lock }()
+
+	// 等待登录锁期间，同一学生的其他请求可能已经登录成功
+	if sess, ok := a.cachedSession(stuID); ok {
+		return sess, nil
+	}
+
+	a.infoMutex.RLock()
+	pwd, exists := a.stuInfo[stuID]
+	a.infoMutex.RUnlock()
+	if !exists {
+		a.sessionMutex.RLock()
+		_, external := a.external[stuID]
+		a.sessionMutex.RUnlock()
+		// 只有外部会话的学生无法重新登录
+		if external {
+			return nil, fmt.Errorf("%w: %s", ErrSessionExpired, stuID)
 		}
-		a.cookies[stuID] = cookieRes{cookie: cookie, createdAt: time.Now()}
-		return cookie, nil
+		return nil, fmt.Errorf("%w: %s", ErrStudentNotFound, stuID)
+	}
+
+	sess, err := a.newSession(ctx, stuID, pwd)
+	if err != nil {
+		return nil, err
 	}
+	a.sessionMutex.Lock()
+	a.sessions[stuID] = sess
+	a.sessionMutex.Unlock()
+	return sess, nil
+}
 
-	return "", fmt.Errorf("student ID %s not found", stuID)
+// GetCookie 返回 "ASP.NET_SessionId=..." 形式的 Cookie 请求头，外部会话返回保存时的完整 Cookie 请求头，
+// 需要其他 cookie 时使用 GetSession
+func (a *auther) GetCookie(ctx context.Context, stuID string) (string, error) {
+	sess, err := a.GetSession(ctx, stuID)
+	if err != nil {
+		return "", err
+	}
+	return sess.cookie, nil
 }
 
-func (a *auther) getCookie(ctx context.Context, stuID, pwd string) (string, error) {
+// newSession 用密码登录，返回登录过程中使用的 cookie jar
+func (a *auther) newSession(ctx context.Context, stuID, pwd string) (*Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.opts.timeouts.GetCookie)
+	defer cancel()
 
-	cli, infos, err := a.getNecessaryInfo(ctx)
+	cli, infos, err := a.getNecessaryInfo(ctx, stuID)
 	if err != nil {
-		return "", fmt.Errorf("failed to get necessary info: %w", err)
+		return nil, fmt.Errorf("failed to get necessary info: %w", err)
 	}
 
-	err = a.login(ctx, cli, stuID, pwd, infos["lt"], infos["execution"])
+	err = a.login(ctx, cli, stuID, pwd, infos)
 	if err != nil {
-		return "", fmt.Errorf("failed to login: %w", err)
+		return nil, fmt.Errorf("failed to login: %w", err)
 	}
 
-	return CookieKey1 + "=" + infos[CookieKey1], nil
+	sess := &Session{
+		StuID:   stuID,
+		Jar:     cli.Jar,
+		LoginAt: time.Now(),
+		base:    a.opts.kjyyBase(),
+		cookie:  CookieKey1 + "=" + infos[CookieKey1],
+	}
+	if a.opts.displayName {
+		sess.DisplayName = a.fetchDisplayName(ctx, cli, stuID)
+	}
+	return sess, nil
 }
 
-func (a *auther) getNecessaryInfo(ctx context.Context) (*http.Client, map[string]string, error) {
-	infos := make(map[string]string)
+func (a *auther) getNecessaryInfo(ctx context.Context, stuID string) (_ *http.Client, _ map[string]string, err error) {
+	defer func(start time.Time) { a.opts.observe(OpGetNecessaryInfo, start, err) }(time.Now())
+	ctx, span := a.opts.startSpan(ctx, SpanGetNecessaryInfo, stuID)
+	defer func() { endSpan(span, err) }()
 
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
@@ -120,10 +243,10 @@ func (a *auther) getNecessaryInfo(ctx context.Context) (*http.Client, map[string
 			fmt.Println("Redirected to:", req.URL)
 			return nil // 允许重定向，模拟浏览器自动跳转
 		},
-		Transport: tr,
+		Transport: a.opts.transport(tr),
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", "http://kjyy.ccnu.edu.cn/clientweb/xcus/ic2/Default.aspx?version=3.00.20181109", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", a.opts.kjyyURL+"/clientweb/xcus/ic2/Default.aspx?version=3.00.20181109", nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -133,7 +256,7 @@ func (a *auther) getNecessaryInfo(ctx context.Context) (*http.Client, map[string
 	req.Header.Set("Connection", "keep-alive")
 	req.Header.Set("Upgrade-Insecure-Requests", "1")
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/137.0.0.0 Safari/537.36")
-	resp, err := client.Do(req)
+	resp, err := a.opts.do(client, stuID, EndpointDefault, req)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -148,18 +271,12 @@ func (a *auther) getNecessaryInfo(ctx context.Context) (*http.Client, map[string
 		return nil, nil, fmt.Errorf("failed to parse response body: %w", err)
 	}
 
-	lt, _ := doc.Find("input[name='lt']").Attr("value")
-	execution, _ := doc.Find("input[name='execution']").Attr("value")
-	if lt == "" || execution == "" {
-		return nil, nil, fmt.Errorf("failed to find lt or execution in the response")
-	}
-
-	infos["lt"] = lt
-	infos["execution"] = execution
+	// 登录页需要的字段由 LoginStrategy 检查
+	infos, _ := parseLoginPage(doc, resp.Request.URL)
 
 	domains := []string{
-		"http://kjyy.ccnu.edu.cn",
-		"https://account.ccnu.edu.cn/cas",
+		a.opts.kjyyURL,
+		a.opts.casURL,
 	}
 
 	var getCookieKey1, getCookieKey2 bool
@@ -188,7 +305,52 @@ func (a *auther) getNecessaryInfo(ctx context.Context) (*http.Client, map[string
 	return client, infos, nil
 }
 
-func (a *auther) login(ctx context.Context, client *http.Client, stuID, pwd, lt, execution string) error {
+// maxLoginSteps 一次登录最多提交表单的次数，包括验证码重试和二次认证
+const maxLoginSteps = 3
+
+// login 按 LoginStrategy 登录统一身份认证。提交后才要求输入验证码或验证码错误时，用返回的新登录页重新生成表单，
+// 要求二次认证时由 LoginStrategy 生成下一步的表单
+func (a *auther) login(ctx context.Context, client *http.Client, stuID, pwd string, infos map[string]string) (err error) {
+	defer func(start time.Time) { a.opts.observe(OpLogin, start, err) }(time.Now())
+	ctx, span := a.opts.startSpan(ctx, SpanLogin, stuID, Attr("login.strategy", a.opts.login.Name()))
+	defer func() { endSpan(span, err) }()
+
+	form, err := a.opts.login.Form(ctx, stuID, pwd, infos)
+	if err != nil {
+		return err
+	}
+
+	for step := 1; ; step++ {
+		next, err := a.submitLogin(ctx, client, stuID, form, infos)
+		if err == nil || step >= maxLoginSteps {
+			return err
+		}
+
+		switch {
+		case errors.Is(err, ErrCaptchaRequired) && a.opts.captcha != nil && next["captchaField"] != "":
+			form, err = a.opts.login.Form(ctx, stuID, pwd, next)
+		case errors.Is(err, ErrMFARequired):
+			form, err = a.opts.login.Continue(ctx, stuID, next)
+		default:
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		infos = next
+	}
+}
+
+// submitLogin 提交一次登录表单，失败时返回统一身份认证返回的页面中的字段
+func (a *auther) submitLogin(ctx context.Context, client *http.Client, stuID string, form url.Values, infos map[string]string) (map[string]string, error) {
+	if field := infos["captchaField"]; field != "" {
+		code, err := a.solveCaptcha(ctx, client, stuID, infos["captchaURL"])
+		if err != nil {
+			return nil, err
+		}
+		form.Set(field, code)
+	}
+
 	var redirected bool
 
 	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
@@ -197,18 +359,13 @@ func (a *auther) login(ctx context.Context, client *http.Client, stuID, pwd, lt,
 	}
 
 	//登录
-	form := url.Values{
-		"username":  {stuID},
-		"password":  {pwd},
-		"lt":        {lt},
-		"execution": {execution},
-		"_eventId":  {"submit"},
-		"submit":    {"登录"},
+	loginURL := a.opts.casURL + "/login?service=" + a.opts.kjyyURL + "/loginall.aspx?page="
+	if action := infos["action"]; action != "" {
+		loginURL = action
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://account.ccnu.edu.cn/cas/login?service=http://kjyy.ccnu.edu.cn/loginall.aspx?page=", strings.NewReader(form.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", loginURL, strings.NewReader(form.Encode()))
 	if err != nil {
-		return fmt.Errorf("failed to create login request: %w", err)
+		return nil, fmt.Errorf("failed to create login request: %w", err)
 	}
 
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
@@ -216,8 +373,8 @@ func (a *auther) login(ctx context.Context, client *http.Client, stuID, pwd, lt,
 	req.Header.Set("Cache-Control", "max-age=0")
 	req.Header.Set("Connection", "keep-alive")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Origin", "https://account.ccnu.edu.cn")
-	req.Header.Set("Referer", "https://account.ccnu.edu.cn/cas/login?service=http://kjyy.ccnu.edu.cn/loginall.aspx?page=")
+	req.Header.Set("Origin", originOf(a.opts.casURL))
+	req.Header.Set("Referer", loginURL)
 	req.Header.Set("Sec-Fetch-Dest", "document")
 	req.Header.Set("Sec-Fetch-Mode", "navigate")
 	req.Header.Set("Sec-Fetch-Site", "same-origin")
@@ -228,16 +385,111 @@ func (a *auther) login(ctx context.Context, client *http.Client, stuID, pwd, lt,
 	req.Header.Set("sec-ch-ua-mobile", "?0")
 	req.Header.Set("sec-ch-ua-platform", `"Windows"`)
 
-	_, err = client.Do(req)
+	resp, err := a.opts.do(client, stuID, EndpointLogin, req)
 	if err != nil {
-		return fmt.Errorf("send request failed: %w", err)
+		return nil, fmt.Errorf("send request failed: %w", err)
 	}
+	defer resp.Body.Close()
 
-	// 检查是否重定向
-	// 如果没有，则代表失败
-	if !redirected {
-		return fmt.Errorf("login did not redirect, check your stuID and password")
+	// 登录成功会重定向回 kjyy。没有重定向，或者重定向到统一身份认证的其他页面（二次认证、修改密码等，
+	// 新版统一身份认证的地址不一定在 casURL 下）都是失败
+	if redirected && underURL(resp.Request.URL, a.opts.kjyyURL) && !underURL(resp.Request.URL, a.opts.casURL) {
+		return nil, nil
 	}
 
-	return nil
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse login page: %v", ErrLoginFailed, err)
+	}
+	next, pageErr := parseLoginPage(doc, resp.Request.URL)
+	switch {
+	case pageErr != nil:
+		return next, pageErr
+	case next["captchaField"] != "" && infos["captchaField"] == "":
+		return next, &LoginError{Reason: ErrCaptchaRequired}
+	case redirected:
+		return next, &LoginError{Reason: ErrLoginFailed, Message: "redirected to " + resp.Request.URL.Path}
+	default:
+		// 页面没有提示原因，不能断定是密码错误
+		return next, &LoginError{Reason: ErrLoginFailed, Message: "no error message on the login page"}
+	}
+}
+
+// fetchDisplayName 获取图书馆系统中显示的姓名，获取失败时返回空字符串，不影响登录。
+// 只有设置了 WithDisplayName 时才会请求
+func (a *auther) fetchDisplayName(ctx context.Context, client *http.Client, stuID string) string {
+	URL := fmt.Sprintf("%s/ClientWeb/pro/ajax/login.aspx?act=is_login&_=%d", a.opts.kjyyURL, time.Now().UnixMilli())
+	req, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Accept", "application/json, text/javascript, */*; q=0.01")
+	req.Header.Set("Referer", a.opts.kjyyURL+"/clientweb/xcus/ic2/Default.aspx")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/137.0.0.0 Safari/537.36")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	resp, err := a.opts.do(client, stuID, EndpointUserInfo, req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		Ret  int `json:"ret"`
+		Data struct {
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil || info.Ret != 1 {
+		return ""
+	}
+	return info.Data.Name
+}
+
+// solveCaptcha 下载验证码图片并交给 CaptchaSolver 识别
+func (a *auther) solveCaptcha(ctx context.Context, client *http.Client, stuID, captchaURL string) (string, error) {
+	if a.opts.captcha == nil {
+		return "", &LoginError{Reason: ErrCaptchaRequired, Message: "no captcha solver configured"}
+	}
+	if captchaURL == "" {
+		return "", &LoginError{Reason: ErrCaptchaRequired, Message: "captcha image not found"}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", captchaURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create captcha request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/137.0.0.0 Safari/537.36")
+	resp, err := a.opts.do(client, stuID, EndpointCaptcha, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get captcha: %w", err)
+	}
+	defer resp.Body.Close()
+	image, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read captcha: %w", err)
+	}
+
+	code, err := a.opts.captcha.Solve(ctx, stuID, image)
+	if err != nil {
+		return "", fmt.Errorf("failed to solve captcha: %w", err)
+	}
+	return code, nil
+}
+
+// underURL 判断 u 是否在 base 之下：scheme 和 host 相同，并且路径以 base 的路径开头
+func underURL(u *url.URL, base string) bool {
+	b, err := url.Parse(base)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == b.Scheme && u.Host == b.Host && strings.HasPrefix(u.Path, b.Path)
+}
+
+// originOf 返回地址的 scheme 和 host 部分，例如 "https://account.ccnu.edu.cn"
+func originOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host
 }
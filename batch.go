@@ -0,0 +1,209 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BatchRequest 为多个学生在同一区域、同一时间段预约座位
+type BatchRequest struct {
+	StuIDs    []string
+	RoomID    string
+	StartTime time.Time
+	EndTime   time.Time
+	// Adjacent 为 true 时尽量为所有学生分配相邻的座位
+	Adjacent bool
+	// Layout 判断座位是否相邻所用的布局，nil 时由座位名称推导
+	Layout *Layout
+	// Parallelism 同时发出的预约请求数量上限，默认 3
+	Parallelism int
+	// MaxAttempts 每个学生最多尝试预约的座位数量，默认 3
+	MaxAttempts int
+}
+
+// BatchResult 单个学生的预约结果
+type BatchResult struct {
+	StuID    string
+	Seat     Seat // 预约成功的座位
+	Attempts int  // 尝试过的座位数量
+	Err      error
+}
+
+// BatchReport 批量预约的结果，Results 的顺序与 BatchRequest.StuIDs 一致
+type BatchReport struct {
+	Results []BatchResult
+	// Adjacent 分配的座位是否相邻
+	Adjacent bool
+}
+
+// Failed 返回预约失败的学生
+func (r *BatchReport) Failed() []BatchResult {
+	var failed []BatchResult
+	for _, res := range r.Results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+type BatchReverser interface {
+	// ReverseAll 只查询一次座位，为每个学生分配不同的座位后并发预约
+	ReverseAll(ctx context.Context, req BatchRequest) (*BatchReport, error)
+}
+
+type batchReverser struct {
+	r Reverser
+}
+
+func NewBatchReverser(r Reverser) BatchReverser {
+	return &batchReverser{r: r}
+}
+
+func (b *batchReverser) ReverseAll(ctx context.Context, req BatchRequest) (*BatchReport, error) {
+	if len(req.StuIDs) == 0 {
+		return nil, fmt.Errorf("no student to reverse for")
+	}
+	if req.Parallelism <= 0 {
+		req.Parallelism = 3
+	}
+	if req.MaxAttempts <= 0 {
+		req.MaxAttempts = 3
+	}
+
+	seats, err := b.r.GetSeatsByTime(ctx, req.StuIDs[0], req.RoomID, req.StartTime, req.EndTime, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get seats: %w", err)
+	}
+
+	assigned, adjacent := assignSeats(seats, len(req.StuIDs), req.Adjacent, req.Layout, req.StartTime, req.EndTime)
+	pool := &seatPool{}
+	if len(assigned) > len(req.StuIDs) {
+		pool.seats = assigned[len(req.StuIDs):]
+	}
+
+	report := &BatchReport{
+		Results:  make([]BatchResult, len(req.StuIDs)),
+		Adjacent: adjacent,
+	}
+
+	sem := make(chan struct{}, req.Parallelism)
+	var wg sync.WaitGroup
+	for i, stuID := range req.StuIDs {
+		var first *Seat
+		if i < len(assigned) {
+			first = &assigned[i]
+		}
+
+		wg.Add(1)
+		go func(i int, stuID string, seat *Seat) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			report.Results[i] = b.reverseOne(ctx, req, stuID, seat, pool)
+		}(i, stuID, first)
+	}
+	wg.Wait()
+
+	return report, nil
+}
+
+// reverseOne 预约分配给学生的座位，座位被拒绝时从剩余座位中取下一个重试。
+// 其它错误（登录失败、服务不可用等）与座位无关，换座位也没有用，直接返回并把座位放回备用座位中
+func (b *batchReverser) reverseOne(ctx context.Context, req BatchRequest, stuID string, seat *Seat, pool *seatPool) BatchResult {
+	res := BatchResult{StuID: stuID}
+	for res.Attempts < req.MaxAttempts {
+		if seat == nil {
+			seat = pool.take()
+		}
+		if seat == nil {
+			if res.Err == nil {
+				res.Err = fmt.Errorf("no available seat left")
+			}
+			return res
+		}
+
+		res.Attempts++
+		err := b.r.Reverse(ctx, stuID, seat.SeatID, req.StartTime, req.EndTime)
+		if err == nil {
+			res.Seat = *seat
+			res.Err = nil
+			return res
+		}
+		res.Err = fmt.Errorf("failed to reverse seat %s: %w", seat.SeatName, err)
+		if !errors.Is(err, ErrReverseRejected) {
+			pool.put(*seat)
+			return res
+		}
+		if ctx.Err() != nil {
+			return res
+		}
+		seat = nil
+	}
+	return res
+}
+
+// seatPool 预约失败后用于重试的剩余座位
+type seatPool struct {
+	mu    sync.Mutex
+	seats []Seat
+}
+
+func (p *seatPool) take() *Seat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.seats) == 0 {
+		return nil
+	}
+	seat := p.seats[0]
+	p.seats = p.seats[1:]
+	return &seat
+}
+
+// put 放回没有被拒绝的座位，其他学生优先使用
+func (p *seatPool) put(seat Seat) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seats = append([]Seat{seat}, p.seats...)
+}
+
+// assignSeats 对座位重新排序，前 n 个座位分配给 n 个学生，其余座位作为备用。
+// adjacent 为 true 时优先选择布局上相邻的 n 个座位，返回的 bool 表示是否分配到了相邻座位
+func assignSeats(seats []Seat, n int, adjacent bool, layout *Layout, startTime, endTime time.Time) ([]Seat, bool) {
+	sorted := make([]Seat, len(seats))
+	copy(sorted, seats)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return seatNameLess(sorted[i].SeatName, sorted[j].SeatName)
+	})
+
+	if !adjacent || n > len(sorted) {
+		return sorted, false
+	}
+	if layout == nil {
+		layout = NewLayoutFromNames(sorted, LayoutRule{})
+	}
+
+	group, err := FindAdjacentFree(sorted, layout, n, startTime, endTime)
+	if err != nil {
+		return sorted, false
+	}
+
+	inGroup := make(map[string]bool, len(group))
+	for _, seat := range group {
+		inGroup[seat.SeatID] = true
+	}
+	res := make([]Seat, 0, len(sorted))
+	res = append(res, group...)
+	for _, seat := range sorted {
+		if !inGroup[seat.SeatID] {
+			res = append(res, seat)
+		}
+	}
+	return res, true
+}
@@ -0,0 +1,127 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchReverseAll(t *testing.T) {
+	start := time.Now().Add(time.Hour)
+	end := start.Add(2 * time.Hour)
+	names := []string{"N1-010", "N1-002", "N1-004", "N1-005", "N1-006", "N1-008"}
+
+	r := &fakeReverser{
+		seats: func(int) []Seat {
+			seats := make([]Seat, 0, len(names))
+			for _, name := range names {
+				seats = append(seats, NewSeat(name, name, "room", "room", start, end, true, nil))
+			}
+			return seats
+		},
+		// N1-005 已经被别人抢走，需要换座位重试
+		reserved: map[string]string{"N1-005": "other"},
+	}
+
+	report, err := NewBatchReverser(r).ReverseAll(context.Background(), BatchRequest{
+		StuIDs:    []string{"a", "b", "c"},
+		RoomID:    "room",
+		StartTime: start,
+		EndTime:   end,
+		Adjacent:  true,
+	})
+	if err != nil {
+		t.Fatalf("reverse all failed: %v", err)
+	}
+	if !report.Adjacent {
+		t.Errorf("expected adjacent seats to be assigned")
+	}
+	if failed := report.Failed(); len(failed) != 0 {
+		t.Fatalf("unexpected failures: %+v", failed)
+	}
+
+	got := make(map[string]bool)
+	for _, res := range report.Results {
+		if got[res.Seat.SeatID] {
+			t.Errorf("seat %s assigned twice", res.Seat.SeatID)
+		}
+		got[res.Seat.SeatID] = true
+		if res.Seat.SeatID == "N1-005" {
+			t.Errorf("seat N1-005 should not be reversed")
+		}
+	}
+	// 默认每桌 4 人，N1-005、N1-006、N1-008 在同一张桌子
+	if !got["N1-006"] || !got["N1-008"] {
+		t.Errorf("expected N1-006 and N1-008 to be reversed, got %v", got)
+	}
+}
+
+// loginFailReverser 学生 bad 登录失败，学生 a 等 bad 失败之后才开始预约
+type loginFailReverser struct {
+	*fakeReverser
+	badCalls atomic.Int32
+	badTried chan struct{}
+}
+
+func (r *loginFailReverser) Reverse(ctx context.Context, stuID, seatID string, startTime, endTime time.Time) error {
+	switch stuID {
+	case "bad":
+		if r.badCalls.Add(1) == 1 {
+			defer close(r.badTried)
+		}
+		return fmt.Errorf("failed to get session: %w", ErrInvalidCredentials)
+	case "a":
+		<-r.badTried
+		time.Sleep(50 * time.Millisecond)
+	}
+	return r.fakeReverser.Reverse(ctx, stuID, seatID, startTime, endTime)
+}
+
+func TestBatchLoginFailureKeepsSpareSeats(t *testing.T) {
+	start := time.Now().Add(time.Hour)
+	end := start.Add(2 * time.Hour)
+	names := []string{"N1-001", "N1-002", "N1-003", "N1-004"}
+
+	r := &loginFailReverser{
+		fakeReverser: &fakeReverser{
+			seats: func(int) []Seat {
+				seats := make([]Seat, 0, len(names))
+				for _, name := range names {
+					seats = append(seats, NewSeat(name, name, "room", "room", start, end, true, nil))
+				}
+				return seats
+			},
+			// 分配给 a 的 N1-001 已经被别人抢走
+			reserved: map[string]string{"N1-001": "other"},
+		},
+		badTried: make(chan struct{}),
+	}
+
+	report, err := NewBatchReverser(r).ReverseAll(context.Background(), BatchRequest{
+		StuIDs:    []string{"a", "bad", "c"},
+		RoomID:    "room",
+		StartTime: start,
+		EndTime:   end,
+	})
+	if err != nil {
+		t.Fatalf("reverse all failed: %v", err)
+	}
+	for _, res := range report.Results {
+		switch res.StuID {
+		case "bad":
+			if !errors.Is(res.Err, ErrInvalidCredentials) || res.Attempts != 1 {
+				t.Errorf("login failure should stop after one attempt, got %d attempts, %v", res.Attempts, res.Err)
+			}
+		default:
+			if res.Err != nil {
+				t.Errorf("student %s should still get a spare seat, got %v", res.StuID, res.Err)
+			}
+		}
+	}
+	if n := r.badCalls.Load(); n != 1 {
+		t.Errorf("a student who cannot log in should not try other seats, got %d calls", n)
+	}
+}
@@ -0,0 +1,228 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Service 图书馆系统依赖的服务，每个服务有单独的熔断器
+type Service string
+
+const (
+	ServiceKJYY Service = "kjyy" // kjyy.ccnu.edu.cn，座位查询与预约
+	ServiceCAS  Service = "cas"  // account.ccnu.edu.cn，统一身份认证
+)
+
+// Service 返回接口所属的服务
+func (ep Endpoint) Service() Service {
+	switch ep {
+	case EndpointDefault, EndpointLogin, EndpointCaptcha:
+		// Default.aspx 会重定向到 CAS 登录页
+		return ServiceCAS
+	default:
+		return ServiceKJYY
+	}
+}
+
+// bestEffort 接口失败不影响主要流程，不计入熔断
+func (ep Endpoint) bestEffort() bool {
+	return ep == EndpointUserInfo
+}
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常放行
+	BreakerOpen                         // 熔断中，直接返回 ErrServiceUnavailable
+	BreakerHalfOpen                     // 放行少量试探请求
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// BreakerConfig 熔断器配置，零值字段使用默认值
+type BreakerConfig struct {
+	// FailureThreshold 连续失败多少次后熔断，默认 5
+	FailureThreshold int
+	// OpenTimeout 熔断多久后进入半开状态，默认 30 秒
+	OpenTimeout time.Duration
+	// HalfOpenRequests 半开状态下同时放行的试探请求数，默认 1
+	HalfOpenRequests int
+	// OnStateChange 状态变化时的回调，用于监控
+	OnStateChange func(s Service, from, to BreakerState)
+}
+
+type Breaker interface {
+	// Allow 判断是否可以向 s 发出请求，不允许时返回 ErrServiceUnavailable；
+	// 允许时必须在请求结束后以请求的错误调用 done
+	Allow(s Service) (done func(err error), err error)
+	// State 返回 s 当前的熔断状态
+	State(s Service) BreakerState
+}
+
+// defaultBreaker 未通过 WithBreaker 指定时，所有 Auther 和 Reverser 共享的熔断器
+var defaultBreaker = NewBreaker(BreakerConfig{})
+
+type breaker struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	now      func() time.Time
+	services map[Service]*breakerState
+	// pending 等待在释放锁之后调用的 OnStateChange
+	pending []func()
+}
+
+type breakerState struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+func NewBreaker(cfg BreakerConfig) Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &breaker{
+		cfg:      cfg,
+		now:      time.Now,
+		services: make(map[Service]*breakerState),
+	}
+}
+
+func (b *breaker) Allow(s Service) (func(err error), error) {
+	defer b.flush()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.get(s)
+	b.advance(s, st)
+	switch st.state {
+	case BreakerOpen:
+		return nil, fmt.Errorf("%w: %s", ErrServiceUnavailable, s)
+	case BreakerHalfOpen:
+		if st.probes >= b.cfg.HalfOpenRequests {
+			return nil, fmt.Errorf("%w: %s", ErrServiceUnavailable, s)
+		}
+		st.probes++
+		return func(err error) { b.done(s, true, err) }, nil
+	default:
+		return func(err error) { b.done(s, false, err) }, nil
+	}
+}
+
+func (b *breaker) State(s Service) BreakerState {
+	defer b.flush()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.get(s)
+	b.advance(s, st)
+	return st.state
+}
+
+func (b *breaker) done(s Service, probe bool, err error) {
+	defer b.flush()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.get(s)
+	if probe {
+		st.probes--
+	}
+	// 调用方取消等与服务无关的错误不计入
+	if err != nil && !isServiceFailure(err) {
+		return
+	}
+
+	if err == nil {
+		st.failures = 0
+		if st.state == BreakerHalfOpen {
+			b.transit(s, st, BreakerClosed)
+		}
+		return
+	}
+
+	st.failures++
+	if st.state == BreakerHalfOpen || (st.state == BreakerClosed && st.failures >= b.cfg.FailureThreshold) {
+		st.openedAt = b.now()
+		b.transit(s, st, BreakerOpen)
+	}
+}
+
+func (b *breaker) get(s Service) *breakerState {
+	st, ok := b.services[s]
+	if !ok {
+		st = &breakerState{}
+		b.services[s] = st
+	}
+	return st
+}
+
+// advance 熔断时间到期后进入半开状态
+func (b *breaker) advance(s Service, st *breakerState) {
+	if st.state == BreakerOpen && b.now().Sub(st.openedAt) >= b.cfg.OpenTimeout {
+		b.transit(s, st, BreakerHalfOpen)
+	}
+}
+
+func (b *breaker) transit(s Service, st *breakerState, to BreakerState) {
+	from := st.state
+	if from == to {
+		return
+	}
+	st.state = to
+	if to == BreakerClosed {
+		st.failures = 0
+	}
+	if fn := b.cfg.OnStateChange; fn != nil {
+		b.pending = append(b.pending, func() { fn(s, from, to) })
+	}
+}
+
+// flush 在不持有锁的情况下调用 OnStateChange，回调中可以再调用 State
+func (b *breaker) flush() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	for _, fn := range pending {
+		fn()
+	}
+}
+
+// isServiceFailure 判断错误是否说明服务本身不可用：网络错误（包括超时）或 5xx 状态码。
+// 调用方主动取消的请求不算
+func isServiceFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr *NetworkError
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode >= http.StatusInternalServerError
+}
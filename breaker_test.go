@@ -0,0 +1,90 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+func TestBreakerStates(t *testing.T) {
+	now := time.Now()
+	var changes []string
+	b := NewBreaker(BreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+		OnStateChange: func(s Service, from, to BreakerState) {
+			changes = append(changes, fmt.Sprintf("%s:%s->%s", s, from, to))
+		},
+	}).(*breaker)
+	b.now = func() time.Time { return now }
+
+	fail := &NetworkError{Endpoint: EndpointSeats, Err: errors.New("timeout")}
+	for i := 0; i < 2; i++ {
+		done, err := b.Allow(ServiceKJYY)
+		if err != nil {
+			t.Fatalf("request %d should be allowed: %v", i, err)
+		}
+		done(fail)
+	}
+	if _, err := b.Allow(ServiceKJYY); !errors.Is(err, ErrServiceUnavailable) {
+		t.Fatalf("expected ErrServiceUnavailable, got %v", err)
+	}
+	// 不同服务互不影响
+	if b.State(ServiceCAS) != BreakerClosed {
+		t.Errorf("cas should stay closed")
+	}
+
+	now = now.Add(time.Minute)
+	if b.State(ServiceKJYY) != BreakerHalfOpen {
+		t.Fatalf("expected half-open after timeout, got %s", b.State(ServiceKJYY))
+	}
+	probe, err := b.Allow(ServiceKJYY)
+	if err != nil {
+		t.Fatalf("probe should be allowed: %v", err)
+	}
+	if _, err := b.Allow(ServiceKJYY); !errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("only one probe should be allowed, got %v", err)
+	}
+	probe(fail)
+	if b.State(ServiceKJYY) != BreakerOpen {
+		t.Fatalf("failed probe should reopen the breaker")
+	}
+
+	now = now.Add(time.Minute)
+	probe, _ = b.Allow(ServiceKJYY)
+	probe(nil)
+	if b.State(ServiceKJYY) != BreakerClosed {
+		t.Fatalf("successful probe should close the breaker")
+	}
+
+	want := []string{"kjyy:closed->open", "kjyy:open->half-open", "kjyy:half-open->open", "kjyy:open->half-open", "kjyy:half-open->closed"}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Errorf("unexpected state changes %v", changes)
+	}
+}
+
+func TestBreakerFailsFast(t *testing.T) {
+	var calls int32
+	r := newTestReverser(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}), WithRetryPolicy(NoRetry()), WithBreaker(NewBreaker(BreakerConfig{FailureThreshold: 3})))
+
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 8, 0)
+	var err error
+	for i := 0; i < 5; i++ {
+		_, err = r.GetSeatsByTime(context.Background(), "a", "101", start, start.Add(time.Hour), false)
+	}
+	if !errors.Is(err, ErrServiceUnavailable) {
+		t.Fatalf("expected ErrServiceUnavailable, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 requests before the breaker opened, got %d", calls)
+	}
+}
@@ -0,0 +1,142 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+// slowHandler 直到客户端断开前都不返回响应
+var slowHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(10 * time.Second):
+	}
+})
+
+func TestReverserHonorsContext(t *testing.T) {
+	r := newTestReverser(t, slowHandler, WithRetryPolicy(NoRetry()))
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 14, 0)
+
+	calls := map[string]func(ctx context.Context) error{
+		"GetSeatsByTime": func(ctx context.Context) error {
+			_, err := r.GetSeatsByTime(ctx, "a", "101", start, start.Add(time.Hour), false)
+			return err
+		},
+		"Reverse": func(ctx context.Context) error {
+			return r.Reverse(ctx, "a", "101", start, start.Add(time.Hour))
+		},
+		"GetReservations": func(ctx context.Context) error {
+			_, err := r.GetReservations(ctx, "a")
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name+"/timeout", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			begin := time.Now()
+			assertInterrupted(t, call(ctx), context.DeadlineExceeded, begin)
+		})
+		t.Run(name+"/cancel", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			begin := time.Now()
+			assertInterrupted(t, call(ctx), context.Canceled, begin)
+		})
+	}
+}
+
+func TestDefaultTimeouts(t *testing.T) {
+	r := newTestReverser(t, slowHandler, WithRetryPolicy(NoRetry()),
+		WithTimeouts(Timeouts{GetSeats: 50 * time.Millisecond, Reverse: 50 * time.Millisecond}))
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 14, 0)
+
+	begin := time.Now()
+	_, err := r.GetSeatsByTime(context.Background(), "a", "101", start, start.Add(time.Hour), false)
+	assertInterrupted(t, err, context.DeadlineExceeded, begin)
+
+	begin = time.Now()
+	err = r.Reverse(context.Background(), "a", "101", start, start.Add(time.Hour))
+	assertInterrupted(t, err, context.DeadlineExceeded, begin)
+}
+
+func TestAttemptTimeoutRetried(t *testing.T) {
+	var calls atomic.Int32
+	r := newTestReverser(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// 第一次尝试超时，第二次正常返回
+		if calls.Add(1) == 1 {
+			slowHandler(w, req)
+			return
+		}
+		w.Write([]byte(`{"ret":1,"data":[]}`))
+	}), WithRetryPolicy(fastRetry), WithTimeouts(Timeouts{GetSeats: 50 * time.Millisecond}))
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 14, 0)
+
+	if _, err := r.GetSeatsByTime(context.Background(), "a", "101", start, start.Add(time.Hour), false); err != nil {
+		t.Fatalf("expected the second attempt to succeed, got %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 attempts, got %d", n)
+	}
+}
+
+// ctxNotifier 记录发送通知时 ctx 的状态
+type ctxNotifier struct {
+	errs []error
+}
+
+func (n *ctxNotifier) Notify(ctx context.Context, _ Notification) error {
+	n.errs = append(n.errs, ctx.Err())
+	return nil
+}
+
+func TestNotifyAfterTimeout(t *testing.T) {
+	n := &ctxNotifier{}
+	r := newTestReverser(t, slowHandler, WithRetryPolicy(NoRetry()), WithNotifier(n))
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 14, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := r.Reverse(ctx, "a", "101", start, start.Add(time.Hour)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	// 预约超时后仍然要能发出失败通知
+	if len(n.errs) != 1 || n.errs[0] != nil {
+		t.Errorf("expected the failure to be notified with a live ctx, got %v", n.errs)
+	}
+}
+
+func TestAutherHonorsContext(t *testing.T) {
+	srv := httptest.NewServer(slowHandler)
+	defer srv.Close()
+
+	a := NewAuther(
+		WithBaseURLs(srv.URL, srv.URL+"/cas"),
+		WithLimiter(NewLimiter(LimiterConfig{})),
+		WithBreaker(NewBreaker(BreakerConfig{})),
+	)
+	_ = a.StoreStuInfo(context.Background(), "a", "pwd")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	_, err := a.GetCookie(ctx, "a")
+	assertInterrupted(t, err, context.DeadlineExceeded, begin)
+}
+
+func assertInterrupted(t *testing.T, err, want error, begin time.Time) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("expected %v, got %v", want, err)
+	}
+	if elapsed := time.Since(begin); elapsed > 2*time.Second {
+		t.Errorf("call was not interrupted in time, took %v", elapsed)
+	}
+}
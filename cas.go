@@ -0,0 +1,161 @@
+package library_reservation
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// CaptchaSolver 识别统一身份认证的验证码，可以对接打码服务，也可以让用户手动输入
+type CaptchaSolver interface {
+	// Solve 根据验证码图片返回验证码文本
+	Solve(ctx context.Context, stuID string, image []byte) (string, error)
+}
+
+// CaptchaSolverFunc 把函数适配为 CaptchaSolver
+type CaptchaSolverFunc func(ctx context.Context, stuID string, image []byte) (string, error)
+
+func (f CaptchaSolverFunc) Solve(ctx context.Context, stuID string, image []byte) (string, error) {
+	return f(ctx, stuID, image)
+}
+
+// NewPromptCaptchaSolver 把验证码图片保存到临时文件，提示用户查看后从 in 读取一行作为验证码，
+// 适合在命令行中使用
+func NewPromptCaptchaSolver(in io.Reader, out io.Writer) CaptchaSolver {
+	reader := bufio.NewReader(in)
+	return CaptchaSolverFunc(func(ctx context.Context, stuID string, image []byte) (string, error) {
+		f, err := os.CreateTemp("", "ccnu-captcha-*.jpg")
+		if err != nil {
+			return "", fmt.Errorf("failed to save captcha: %w", err)
+		}
+		// 输入完成后删除图片
+		defer os.Remove(f.Name())
+		defer f.Close()
+		if _, err := f.Write(image); err != nil {
+			return "", fmt.Errorf("failed to save captcha: %w", err)
+		}
+
+		fmt.Fprintf(out, "请打开 %s 查看验证码，并输入学号 %s 的验证码: ", f.Name(), stuID)
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read captcha: %w", err)
+		}
+		return strings.TrimSpace(line), nil
+	})
+}
+
+// 登录页中可能的验证码输入框名称
+var captchaFieldNames = []string{"captcha", "authcode", "validateCode", "vcode", "captchaResponse"}
+
+// 二次认证页面中可能的动态码输入框名称
+var mfaFieldNames = []string{"dynamicCode", "otpCode", "totpCode", "smsCode"}
+
+// parseLoginPage 从统一身份认证的页面中取出登录需要的字段：登录表单中的隐藏字段（lt、execution、pwdEncryptSalt 等）、
+// 表单提交地址 action、验证码输入框 captchaField 和图片地址 captchaURL、动态码输入框 mfaField，
+// 以及页面上提示的登录失败原因，页面没有提示错误时返回的 error 为 nil
+func parseLoginPage(doc *goquery.Document, base *url.URL) (map[string]string, error) {
+	infos := make(map[string]string)
+
+	// 登录表单是密码框所在的表单，二次认证页面上没有密码框，是动态码输入框所在的表单。
+	// 新版统一身份认证的登录页上还有短信登录、扫码登录等表单，各自有不同的 execution，
+	// 所以隐藏字段只从登录表单中取，找不到登录表单时才从整个页面中取
+	input := doc.Find("input[type='password']").First()
+	if input.Length() == 0 {
+		for _, name := range mfaFieldNames {
+			if mfa := doc.Find("input[name='" + name + "']").First(); mfa.Length() > 0 {
+				infos["mfaField"] = name
+				input = mfa
+				break
+			}
+		}
+	}
+	form := input.Closest("form")
+	if action, ok := form.Attr("action"); ok && action != "" {
+		infos["action"] = resolveURL(base, action)
+	}
+	scope := doc.Selection
+	if form.Length() > 0 {
+		scope = form
+	}
+
+	scope.Find("input[type='hidden']").Each(func(_ int, s *goquery.Selection) {
+		// 有的页面只给隐藏字段设置了 id，例如 pwdEncryptSalt
+		key, _ := s.Attr("name")
+		if key == "" {
+			key, _ = s.Attr("id")
+		}
+		if v, _ := s.Attr("value"); key != "" && v != "" {
+			if _, exists := infos[key]; !exists {
+				infos[key] = v
+			}
+		}
+	})
+
+	for _, name := range captchaFieldNames {
+		if doc.Find("input[name='"+name+"']").Length() == 0 {
+			continue
+		}
+		infos["captchaField"] = name
+		if src, ok := doc.Find("img#captchaImg, img.captcha, img[src*='captcha'], img[src*='Captcha']").First().Attr("src"); ok {
+			infos["captchaURL"] = resolveURL(base, src)
+		}
+		break
+	}
+
+	msg := strings.TrimSpace(doc.Find("#errormsg, #msg, #showErrorTip, .errors, .login-error, .alert-danger").First().Text())
+	if msg != "" {
+		err := classifyLoginMessage(msg)
+		// 二次认证页面上的“验证码错误”指的是动态码
+		if errors.Is(err, ErrCaptchaRequired) && infos["captchaField"] == "" && infos["mfaField"] != "" {
+			err = &LoginError{Reason: ErrMFARequired, Message: msg}
+		}
+		return infos, err
+	}
+	if doc.Find("input[name='newPassword'], input[name='confirmPassword'], input[name='newPwd']").Length() > 0 {
+		return infos, &LoginError{Reason: ErrPasswordChangeRequired}
+	}
+	if infos["mfaField"] != "" {
+		return infos, &LoginError{Reason: ErrMFARequired}
+	}
+	return infos, nil
+}
+
+// classifyLoginMessage 根据统一身份认证页面上的提示判断登录失败的原因
+func classifyLoginMessage(msg string) error {
+	contains := func(words ...string) bool {
+		for _, w := range words {
+			if strings.Contains(msg, w) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case contains("验证码"):
+		return &LoginError{Reason: ErrCaptchaRequired, Message: msg}
+	case contains("锁定", "冻结", "禁用", "停用"):
+		return &LoginError{Reason: ErrAccountLocked, Message: msg}
+	case contains("修改密码", "密码已过期", "重置密码", "初始密码", "弱密码"):
+		return &LoginError{Reason: ErrPasswordChangeRequired, Message: msg}
+	case contains("密码错误", "用户名或密码", "账号或密码", "不存在", "认证失败"):
+		return &LoginError{Reason: ErrInvalidCredentials, Message: msg}
+	default:
+		return &LoginError{Reason: ErrLoginFailed, Message: msg}
+	}
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil || base == nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
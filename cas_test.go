@@ -0,0 +1,217 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const casLoginPage = `<html><body><form id="fm1" method="post">
+<input name="username"/><input type="password" name="password"/>%s
+<input type="hidden" name="lt" value="LT-1"/><input type="hidden" name="execution" value="e1s1"/>
+<span id="errormsg">%s</span></form></body></html>`
+
+// newFakeCAS 模拟 kjyy 和统一身份认证，login 处理登录表单的提交
+func newFakeCAS(t *testing.T, login http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/clientweb/xcus/ic2/Default.aspx", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: CookieKey1, Value: "sid", Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: CookieKey2, Value: "jsid", Path: "/"})
+		fmt.Fprintf(w, casLoginPage, "", "")
+	})
+	mux.HandleFunc("/cas/login", login)
+	mux.HandleFunc("/cas/captcha.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("captcha-image"))
+	})
+	mux.HandleFunc("/cas/pwdChange", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<form><input type="password" name="newPassword"/><input type="password" name="confirmPassword"/></form>`)
+	})
+	mux.HandleFunc("/loginall.aspx", func(w http.ResponseWriter, r *http.Request) {})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestAuther(srv *httptest.Server, opts ...Option) Auther {
+	opts = append([]Option{
+		WithBaseURLs(srv.URL, srv.URL+"/cas"),
+		WithLimiter(NewLimiter(LimiterConfig{})),
+		WithBreaker(NewBreaker(BreakerConfig{})),
+	}, opts...)
+	a := NewAuther(opts...)
+	_ = a.StoreStuInfo(context.Background(), "2023000001", "pwd")
+	return a
+}
+
+func TestCASLoginErrors(t *testing.T) {
+	errorPage := func(msg string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, casLoginPage, "", msg)
+		}
+	}
+	cases := []struct {
+		name  string
+		login http.HandlerFunc
+		want  error
+	}{
+		{"success", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/loginall.aspx?page=", http.StatusFound)
+		}, nil},
+		{"invalid", errorPage("用户名或密码错误"), ErrInvalidCredentials},
+		{"locked", errorPage("您的账号已被锁定，请 30 分钟后再试"), ErrAccountLocked},
+		{"password change", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/cas/pwdChange", http.StatusFound)
+		}, ErrPasswordChangeRequired},
+		{"captcha without solver", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, casLoginPage, `<input name="captcha"/><img id="captchaImg" src="captcha.jpg"/>`, "请输入验证码")
+		}, ErrCaptchaRequired},
+		{"no message", errorPage(""), ErrLoginFailed},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := newTestAuther(newFakeCAS(t, c.login))
+			cookie, err := a.GetCookie(context.Background(), "2023000001")
+			if c.want == nil {
+				if err != nil || cookie != CookieKey1+"=sid" {
+					t.Fatalf("expected login to succeed, got %q, %v", cookie, err)
+				}
+				return
+			}
+			if !errors.Is(err, c.want) || !errors.Is(err, ErrLoginFailed) {
+				t.Errorf("expected %v, got %v", c.want, err)
+			}
+			if c.want == ErrLoginFailed && errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("a page without a message should not be reported as invalid credentials, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCASLoginCaptcha(t *testing.T) {
+	var posts int32
+	srv := newFakeCAS(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		if r.FormValue("captcha") == "abcd" {
+			http.Redirect(w, r, "/loginall.aspx?page=", http.StatusFound)
+			return
+		}
+		fmt.Fprintf(w, casLoginPage, `<input name="captcha"/><img id="captchaImg" src="captcha.jpg"/>`, "")
+	})
+
+	var image string
+	solver := CaptchaSolverFunc(func(ctx context.Context, stuID string, img []byte) (string, error) {
+		image = string(img)
+		return "abcd", nil
+	})
+	a := newTestAuther(srv, WithCaptchaSolver(solver))
+	if _, err := a.GetCookie(context.Background(), "2023000001"); err != nil {
+		t.Fatalf("expected login with captcha to succeed, got %v", err)
+	}
+	if image != "captcha-image" || posts != 2 {
+		t.Errorf("unexpected captcha flow: image %q, %d posts", image, posts)
+	}
+}
+
+func TestParseLoginPageForms(t *testing.T) {
+	// 新版统一身份认证的页面上有短信登录、账号密码登录和扫码登录三个表单，各自有不同的 execution
+	const page = `<html><body>
+<form id="phoneFromId" action="/authserver/login?type=dynamic"><input name="dynamicCode"/>
+<input type="hidden" name="execution" value="sms"/><input type="hidden" name="lt" value="LT-sms"/></form>
+<form id="pwdFromId" action="/authserver/login"><input name="username"/><input type="password" name="passwordText"/>
+<input type="hidden" id="pwdEncryptSalt" value="salt"/><input type="hidden" name="execution" value="pwd"/></form>
+<form id="qrLoginForm" action="/authserver/login?type=qr"><input type="hidden" name="execution" value="qr"/><input type="hidden" name="uuid" value="u1"/></form>
+</body></html>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("https://ids.ccnu.edu.cn/authserver/login")
+	infos, err := parseLoginPage(doc, base)
+
+	if infos["execution"] != "pwd" || infos["pwdEncryptSalt"] != "salt" {
+		t.Errorf("hidden fields should come from the password form, got %v", infos)
+	}
+	if _, ok := infos["lt"]; ok {
+		t.Errorf("lt of the SMS form should be ignored, got %v", infos)
+	}
+	if _, ok := infos["uuid"]; ok {
+		t.Errorf("fields of the QR form should be ignored, got %v", infos)
+	}
+	if infos["action"] != "https://ids.ccnu.edu.cn/authserver/login" {
+		t.Errorf("unexpected action %q", infos["action"])
+	}
+	if err != nil || infos["mfaField"] != "" {
+		t.Errorf("the SMS login form is not a second factor page, got %v, %v", infos["mfaField"], err)
+	}
+}
+
+func TestPromptCaptchaSolver(t *testing.T) {
+	var out strings.Builder
+	solver := NewPromptCaptchaSolver(strings.NewReader(" ab12 \n"), &out)
+	code, err := solver.Solve(context.Background(), "2023000001", []byte("jpg"))
+	if err != nil || code != "ab12" {
+		t.Fatalf("expected ab12, got %q, %v", code, err)
+	}
+	path := strings.Fields(strings.TrimPrefix(out.String(), "请打开 "))[0]
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("captcha image %s should be removed, got %v", path, err)
+	}
+}
+
+func TestCaptchaDoesNotBlockOtherStudents(t *testing.T) {
+	srv := newFakeCAS(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("username") == "2023000001" && r.FormValue("captcha") == "" {
+			fmt.Fprintf(w, casLoginPage, `<input name="captcha"/><img id="captchaImg" src="captcha.jpg"/>`, "")
+			return
+		}
+		http.Redirect(w, r, "/loginall.aspx?page=", http.StatusFound)
+	})
+
+	// 2023000001 的验证码一直没有输入
+	waiting, release := make(chan struct{}), make(chan struct{})
+	solver := CaptchaSolverFunc(func(ctx context.Context, stuID string, img []byte) (string, error) {
+		close(waiting)
+		<-release
+		return "abcd", nil
+	})
+	a := newTestAuther(srv, WithCaptchaSolver(solver))
+	_ = a.StoreStuInfo(context.Background(), "2023000002", "pwd")
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.GetCookie(context.Background(), "2023000001")
+		done <- err
+	}()
+	<-waiting
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := a.GetCookie(ctx, "2023000002"); err != nil {
+		t.Errorf("another student's login should not wait for the captcha, got %v", err)
+	}
+	store := a.(SessionStore)
+	if err := store.StoreSession(ctx, "2023000003", "ASP.NET_SessionId=ext"); err != nil {
+		t.Fatal(err)
+	}
+	if cookie, err := a.GetCookie(ctx, "2023000003"); err != nil || cookie != "ASP.NET_SessionId=ext" {
+		t.Errorf("external session should be returned while a captcha is pending, got %q, %v", cookie, err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("expected the captcha login to finish, got %v", err)
+	}
+}
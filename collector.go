@@ -0,0 +1,195 @@
+package library_reservation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+type Collector interface {
+	// Run 按间隔采集快照，ctx 结束后返回
+	Run(ctx context.Context) error
+	// CollectOnce 立即采集一次所有区域的快照，部分区域失败时仍然写入其它区域的记录，返回合并后的错误
+	CollectOnce(ctx context.Context) error
+}
+
+type CollectorOption func(*collector)
+
+// WithCollectInterval 设置采集间隔，默认 15 分钟
+func WithCollectInterval(d time.Duration) CollectorOption {
+	return func(c *collector) {
+		if d > 0 {
+			c.interval = d
+		}
+	}
+}
+
+// WithCollectWindows 设置每次采集查询的时间段，默认为今天剩余的开放时间和明天全天
+func WithCollectWindows(fn func(now time.Time) []Period) CollectorOption {
+	return func(c *collector) {
+		if fn != nil {
+			c.windows = fn
+		}
+	}
+}
+
+// WithOwnerSalt 设置匿名化占用者时使用的盐，必须设置。姓名的取值范围很小，不加盐或盐被猜到时哈希可以被穷举还原，
+// 所以盐应当是足够长的随机字符串并妥善保存；更换盐后同一个人的哈希也会改变
+func WithOwnerSalt(salt string) CollectorOption {
+	return func(c *collector) {
+		c.salt = salt
+	}
+}
+
+// WithCollectErrorHandler 设置采集失败时的回调，默认用 log 输出到标准错误
+func WithCollectErrorHandler(fn func(err error)) CollectorOption {
+	return func(c *collector) {
+		if fn != nil {
+			c.onError = fn
+		}
+	}
+}
+
+type collector struct {
+	r       Reverser
+	store   OccupancyStore
+	stuID   string
+	roomIDs []string
+
+	interval time.Duration
+	windows  func(now time.Time) []Period
+	salt     string
+	onError  func(err error)
+}
+
+// NewCollector 使用 stuID 的登录状态定时采集 roomIDs 的座位占用情况，写入 store
+func NewCollector(r Reverser, store OccupancyStore, stuID string, roomIDs []string, opts ...CollectorOption) Collector {
+	c := &collector{
+		r:        r,
+		store:    store,
+		stuID:    stuID,
+		roomIDs:  roomIDs,
+		interval: 15 * time.Minute,
+		windows:  defaultCollectWindows,
+		onError: func(err error) {
+			log.Println("collect occupancy failed:", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *collector) Run(ctx context.Context) error {
+	if c.salt == "" {
+		return ErrOwnerSaltRequired
+	}
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.CollectOnce(ctx); err != nil {
+			c.onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *collector) CollectOnce(ctx context.Context) error {
+	if c.salt == "" {
+		return ErrOwnerSaltRequired
+	}
+	now := time.Now()
+	var (
+		records []OccupancyRecord
+		errs    []error
+	)
+
+	// 某个区域查询失败时继续采集其它区域，已经采集到的记录照常写入
+	for _, window := range c.windows(now) {
+		for _, roomID := range c.roomIDs {
+			seats, err := c.r.GetSeatsByTime(ctx, c.stuID, roomID, window.StartTime, window.EndTime, false)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get seats of room %s for %s: %w", roomID, formatPeriod(window), err))
+				if ctx.Err() != nil {
+					return errors.Join(errs...)
+				}
+				continue
+			}
+			for _, seat := range seats {
+				records = append(records, c.record(now, roomID, seat, window))
+			}
+		}
+	}
+
+	if len(records) > 0 {
+		if err := c.store.Append(ctx, records); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *collector) record(now time.Time, roomID string, seat Seat, window Period) OccupancyRecord {
+	free, _ := seat.IsFree(window.StartTime, window.EndTime)
+	occupied := make([]Period, 0, len(seat.OccupyStates))
+	for _, p := range seat.OccupyStates {
+		p.Owner = AnonymizeOwner(c.salt, p.Owner)
+		occupied = append(occupied, p)
+	}
+	return OccupancyRecord{
+		At:          now,
+		RoomID:      roomID,
+		RoomName:    seat.RoomName,
+		SeatID:      seat.SeatID,
+		SeatName:    seat.SeatName,
+		WindowStart: window.StartTime,
+		WindowEnd:   window.EndTime,
+		Free:        free,
+		Occupied:    occupied,
+	}
+}
+
+// AnonymizeOwner 把占用者姓名替换为加盐哈希，同一个人在同一个盐下得到相同的结果。salt 为空时结果可以被穷举还原
+func AnonymizeOwner(salt, owner string) string {
+	if owner == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(salt + owner))
+	return hex.EncodeToString(sum[:6])
+}
+
+const (
+	openHour  = 8  // 开馆时间
+	closeHour = 22 // 闭馆时间
+)
+
+func defaultCollectWindows(now time.Time) []Period {
+	now = now.In(pkg.GetCurrentShanghaiTime().Location())
+	var windows []Period
+
+	todayClose := pkg.CreateShanghaiTime(now.Year(), int(now.Month()), now.Day(), closeHour, 0)
+	todayOpen := pkg.CreateShanghaiTime(now.Year(), int(now.Month()), now.Day(), openHour, 0)
+	start := pkg.MaxTime(pkg.RoundUpToNext5Min(now), todayOpen)
+	if start.Before(todayClose) {
+		windows = append(windows, Period{StartTime: start, EndTime: todayClose})
+	}
+
+	tomorrow := now.AddDate(0, 0, 1)
+	windows = append(windows, Period{
+		StartTime: pkg.CreateShanghaiTime(tomorrow.Year(), int(tomorrow.Month()), tomorrow.Day(), openHour, 0),
+		EndTime:   pkg.CreateShanghaiTime(tomorrow.Year(), int(tomorrow.Month()), tomorrow.Day(), closeHour, 0),
+	})
+	return windows
+}
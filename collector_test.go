@@ -0,0 +1,136 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectOnce(t *testing.T) {
+	start := time.Now().Add(time.Hour).Truncate(time.Minute)
+	end := start.Add(3 * time.Hour)
+
+	r := &fakeReverser{seats: func(int) []Seat {
+		return []Seat{
+			NewSeat("1", "N1-001", "room", "一楼", start, end, true, nil),
+			NewSeat("2", "N1-002", "room", "一楼", start, end, false, []Period{{Owner: "张三", StartTime: start, EndTime: end}}),
+		}
+	}}
+	store := NewJSONLStore(filepath.Join(t.TempDir(), "occupancy.jsonl"))
+	c := NewCollector(r, store, "stu", []string{"room"},
+		WithOwnerSalt("salt"),
+		WithCollectWindows(func(time.Time) []Period {
+			return []Period{{StartTime: start, EndTime: end}}
+		}),
+	)
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := c.CollectOnce(ctx); err != nil {
+			t.Fatalf("collect failed: %v", err)
+		}
+	}
+
+	var records []OccupancyRecord
+	err := store.Scan(ctx, func(rec OccupancyRecord) error {
+		records = append(records, rec)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+
+	occ := records[1]
+	if occ.SeatID != "2" || occ.Free || len(occ.Occupied) != 1 {
+		t.Fatalf("unexpected record %+v", occ)
+	}
+	if owner := occ.Occupied[0].Owner; owner == "张三" || owner != AnonymizeOwner("salt", "张三") {
+		t.Errorf("owner should be anonymized, got %q", owner)
+	}
+	if !occ.Occupied[0].StartTime.Equal(start) || !occ.WindowEnd.Equal(end) {
+		t.Errorf("time not preserved: %+v", occ)
+	}
+}
+
+func TestCollectorRequiresSalt(t *testing.T) {
+	r := &fakeReverser{seats: func(int) []Seat { return nil }}
+	c := NewCollector(r, NewJSONLStore(filepath.Join(t.TempDir(), "occupancy.jsonl")), "stu", []string{"room"})
+	if err := c.CollectOnce(context.Background()); !errors.Is(err, ErrOwnerSaltRequired) {
+		t.Errorf("expected ErrOwnerSaltRequired, got %v", err)
+	}
+	if err := c.Run(context.Background()); !errors.Is(err, ErrOwnerSaltRequired) {
+		t.Errorf("expected Run to refuse without a salt, got %v", err)
+	}
+}
+
+func TestCollectorErrorHandler(t *testing.T) {
+	start := time.Now().Add(time.Hour).Truncate(time.Minute)
+	r := &fakeReverser{seats: func(int) []Seat {
+		return []Seat{NewSeat("1", "N1-001", "room", "一楼", start, start.Add(time.Hour), true, nil)}
+	}}
+	// 目录不存在，写入失败
+	store := NewJSONLStore(filepath.Join(t.TempDir(), "missing", "occupancy.jsonl"))
+	var errs []error
+	c := NewCollector(r, store, "stu", []string{"room"},
+		WithOwnerSalt("salt"),
+		WithCollectErrorHandler(func(err error) { errs = append(errs, err) }),
+		WithCollectWindows(func(time.Time) []Period {
+			return []Period{{StartTime: start, EndTime: start.Add(time.Hour)}}
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Run to stop with the ctx, got %v", err)
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected the failed collection to be reported once, got %v", errs)
+	}
+}
+
+// failRoomReverser 查询 bad 区域时总是失败
+type failRoomReverser struct {
+	*fakeReverser
+}
+
+func (r *failRoomReverser) GetSeatsByTime(ctx context.Context, stuID, roomID string, startTime, endTime time.Time, onlyAvailable bool, filters ...SeatFilter) ([]Seat, error) {
+	if roomID == "bad" {
+		return nil, errors.New("connection reset")
+	}
+	return r.fakeReverser.GetSeatsByTime(ctx, stuID, roomID, startTime, endTime, onlyAvailable, filters...)
+}
+
+func TestCollectOncePartialFailure(t *testing.T) {
+	start := time.Now().Add(time.Hour).Truncate(time.Minute)
+	end := start.Add(time.Hour)
+	r := &failRoomReverser{&fakeReverser{seats: func(int) []Seat {
+		return []Seat{NewSeat("1", "N1-001", "room", "一楼", start, end, true, nil)}
+	}}}
+	store := NewJSONLStore(filepath.Join(t.TempDir(), "occupancy.jsonl"))
+	c := NewCollector(r, store, "stu", []string{"bad", "room"},
+		WithOwnerSalt("salt"),
+		WithCollectWindows(func(time.Time) []Period {
+			return []Period{{StartTime: start, EndTime: end}, {StartTime: end, EndTime: end.Add(time.Hour)}}
+		}),
+	)
+
+	err := c.CollectOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "room bad") {
+		t.Fatalf("expected the failure of room bad to be reported, got %v", err)
+	}
+	var rooms []string
+	_ = store.Scan(context.Background(), func(rec OccupancyRecord) error {
+		rooms = append(rooms, rec.RoomID)
+		return nil
+	})
+	if len(rooms) != 2 || rooms[0] != "room" || rooms[1] != "room" {
+		t.Errorf("records of the other room should still be stored, got %v", rooms)
+	}
+}
@@ -0,0 +1,106 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrStudentNotFound 没有通过 StoreStuInfo 保存该学生的信息
+	ErrStudentNotFound = errors.New("student ID not found")
+	// ErrLoginFailed 统一身份认证登录失败，下面几种更具体的原因都可以用 errors.Is 判断为 ErrLoginFailed
+	ErrLoginFailed = errors.New("login failed")
+	// ErrInvalidCredentials 学号或密码错误
+	ErrInvalidCredentials = fmt.Errorf("%w: check your stuID and password", ErrLoginFailed)
+	// ErrCaptchaRequired 需要输入验证码，但没有配置 CaptchaSolver 或验证码错误
+	ErrCaptchaRequired = fmt.Errorf("%w: captcha required", ErrLoginFailed)
+	// ErrAccountLocked 账号被锁定或冻结
+	ErrAccountLocked = fmt.Errorf("%w: account locked", ErrLoginFailed)
+	// ErrMFARequired 需要输入短信验证码等第二因素，但登录方式无法提供
+	ErrMFARequired = fmt.Errorf("%w: second factor required", ErrLoginFailed)
+	// ErrPasswordChangeRequired 需要先在统一身份认证页面修改密码
+	ErrPasswordChangeRequired = fmt.Errorf("%w: password change required", ErrLoginFailed)
+	// ErrSessionExpired 通过 StoreSession 或 ImportCookies 提供的 cookie 已经失效，需要重新在浏览器中登录
+	ErrSessionExpired = errors.New("session expired")
+	// ErrLoggedOut 图书馆系统提示未登录，会话已被丢弃，下次请求会重新登录，可以重试
+	ErrLoggedOut = errors.New("logged out by library system")
+	// ErrNoAvailableSeat 时间段内没有空闲的座位
+	ErrNoAvailableSeat = errors.New("no available seats found in the specified time range")
+	// ErrReverseRejected 图书馆系统拒绝了预约请求，例如座位已被预约、超出可预约时间
+	ErrReverseRejected = errors.New("failed to reverse")
+	// ErrRequestRejected 图书馆系统返回了 ret != 1 的查询结果
+	ErrRequestRejected = errors.New("request rejected")
+	// ErrServiceUnavailable 服务连续失败，熔断器已打开，请求没有被发出
+	ErrServiceUnavailable = errors.New("service unavailable")
+	// ErrOwnerSaltRequired Collector 没有设置 WithOwnerSalt，占用者姓名无法安全地匿名化
+	ErrOwnerSaltRequired = errors.New("owner salt required")
+)
+
+// LoginError 统一身份认证页面提示的登录失败原因
+type LoginError struct {
+	Reason  error  // ErrInvalidCredentials、ErrCaptchaRequired 等
+	Message string // 页面上的提示文字
+}
+
+func (e *LoginError) Error() string {
+	if e.Message == "" {
+		return e.Reason.Error()
+	}
+	return e.Reason.Error() + ": " + e.Message
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Reason
+}
+
+// NetworkError 请求没有得到响应，例如连接失败、超时
+type NetworkError struct {
+	Endpoint Endpoint
+	Err      error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("request to %s failed: %v", e.Endpoint, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPError 图书馆系统返回了 4xx 或 5xx 状态码
+type HTTPError struct {
+	Endpoint   Endpoint
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("request to %s returned unexpected status code: %d", e.Endpoint, e.StatusCode)
+}
+
+// IsRetryable 判断错误是否是暂时性的：网络错误（包括单次尝试超时），或 408、429、5xx 状态码。
+// 取消导致的错误不可重试；调用方的 ctx 是否已经结束由重试逻辑根据 ctx 判断
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	// 单次尝试的超时（Timeouts），或者会话被图书馆系统注销、重新登录后可以继续
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrLoggedOut) {
+		return true
+	}
+
+	var netErr *NetworkError
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return httpErr.StatusCode >= 500
+	}
+	return false
+}
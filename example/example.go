@@ -6,6 +6,7 @@ import (
 	"fmt"
 	libraryreservation "github.com/chencheng8888/ccnu-library-reservations"
 	"math/rand"
+	"os"
 	"time"
 )
 
@@ -24,7 +25,8 @@ func main() {
 	flag.Parse()
 
 	ctx := context.Background()
-	auth := libraryreservation.NewAuther()
+	// 需要验证码时在命令行中手动输入
+	auth := libraryreservation.NewAuther(libraryreservation.WithCaptchaSolver(libraryreservation.NewPromptCaptchaSolver(os.Stdin, os.Stdout)))
 	r := libraryreservation.NewReverser(auth)
 
 	err := auth.StoreStuInfo(ctx, stuId, password)
@@ -0,0 +1,91 @@
+package library_reservation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// FlexibleQuery 不固定起止时间的查询：在 Outer 内寻找长度在 [MinDuration, MaxDuration] 之间的空闲时间段
+type FlexibleQuery struct {
+	Outer       Period
+	MinDuration time.Duration
+	// MaxDuration 候选时间段的最大长度，0 表示不限制
+	MaxDuration time.Duration
+	Filters     []SeatFilter
+}
+
+// FreeBlocks 一个座位的候选时间段
+type FreeBlocks struct {
+	Seat     Seat
+	Earliest Period // 开始时间最早的候选时间段
+	Longest  Period // 最长的候选时间段，长度不超过 MaxDuration
+}
+
+// FindFreeBlocks 根据 IsFree 返回的空闲时间段，为每个座位计算最早和最长的候选时间段，
+// 没有满足 minDuration 的空闲时间段的座位不会出现在结果中。
+// 结果按最早开始时间排序，开始时间相同时最长时间段更长的在前
+func FindFreeBlocks(seats []Seat, outer Period, minDuration, maxDuration time.Duration) []FreeBlocks {
+	var res []FreeBlocks
+	for _, seat := range seats {
+		_, periods := seat.IsFree(outer.StartTime, outer.EndTime)
+
+		var (
+			blocks       FreeBlocks
+			found        bool
+			longestAvail time.Duration
+		)
+		for _, p := range periods {
+			if p.Duration() < minDuration {
+				continue
+			}
+			if !found {
+				blocks.Earliest = capPeriod(p, maxDuration)
+				found = true
+			}
+			if p.Duration() > longestAvail {
+				longestAvail = p.Duration()
+				blocks.Longest = capPeriod(p, maxDuration)
+			}
+		}
+		if !found {
+			continue
+		}
+		blocks.Seat = seat
+		res = append(res, blocks)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if !a.Earliest.StartTime.Equal(b.Earliest.StartTime) {
+			return a.Earliest.StartTime.Before(b.Earliest.StartTime)
+		}
+		return a.Longest.Duration() > b.Longest.Duration()
+	})
+	return res
+}
+
+// capPeriod 从 p 的开始时间起截取不超过 maxDuration 的一段
+func capPeriod(p Period, maxDuration time.Duration) Period {
+	if maxDuration > 0 && p.Duration() > maxDuration {
+		p.EndTime = p.StartTime.Add(maxDuration)
+	}
+	return p
+}
+
+// SearchFlexible 查询 roomID 在 q.Outer 内的座位，返回每个座位的候选时间段
+func (s *searcher) SearchFlexible(ctx context.Context, stuID, roomID string, q FlexibleQuery) ([]FreeBlocks, error) {
+	if q.Outer.IsEmpty() {
+		return nil, fmt.Errorf("invalid outer window: %s", formatPeriod(q.Outer))
+	}
+	if q.MaxDuration > 0 && q.MaxDuration < q.MinDuration {
+		return nil, fmt.Errorf("max duration %v is less than min duration %v", q.MaxDuration, q.MinDuration)
+	}
+
+	seats, err := s.r.GetSeatsByTime(ctx, stuID, roomID, q.Outer.StartTime, q.Outer.EndTime, false, q.Filters...)
+	if err != nil {
+		return nil, err
+	}
+	return FindFreeBlocks(seats, q.Outer, q.MinDuration, q.MaxDuration), nil
+}
@@ -0,0 +1,256 @@
+package library_reservation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SeatPosition 座位在区域平面图中的位置
+type SeatPosition struct {
+	Row   int    `json:"row"`
+	Col   int    `json:"col"`
+	Table string `json:"table"` // 同一张桌子的座位 Table 相同
+}
+
+// maxLayoutSize 平面图的最大行数和列数，防止错误的布局分配过大的网格
+const maxLayoutSize = 1000
+
+// valid 判断位置是否在平面图范围内
+func (p SeatPosition) valid() bool {
+	return p.Row >= 0 && p.Row < maxLayoutSize && p.Col >= 0 && p.Col < maxLayoutSize
+}
+
+// Layout 区域的座位布局
+//
+// getSeats 请求 device.aspx 时已经带上了 display=fp（平面图模式），但返回的每个座位只有 crawSeatInfo 中的字段：
+// 编号、名称、所属区域和楼宇、状态、预约规则、开放和占用时间段，没有行列或坐标。
+// 因此无法从接口得到真实布局，默认布局由座位编号推导，
+// 如果已经知道真实布局，可以通过 LoadLayout 载入
+type Layout struct {
+	Positions map[string]SeatPosition `json:"positions"` // SeatID -> 位置
+}
+
+// LayoutRule 由座位编号推导布局的规则
+type LayoutRule struct {
+	SeatsPerTable int // 每张桌子的座位数，桌子两侧各坐一半，默认 4
+	TablesPerRow  int // 每排的桌子数，默认 5
+}
+
+// NewLayoutFromNames 根据 "N1M-001" 这样的座位名称推导布局：
+// 编号连续的座位依次坐满一张桌子，桌子按行排列；前缀不同的座位分区域依次向下排列
+func NewLayoutFromNames(seats []Seat, rule LayoutRule) *Layout {
+	if rule.SeatsPerTable <= 0 {
+		rule.SeatsPerTable = 4
+	}
+	if rule.TablesPerRow <= 0 {
+		rule.TablesPerRow = 5
+	}
+	perSide := (rule.SeatsPerTable + 1) / 2
+
+	type numbered struct {
+		id  string
+		num int
+	}
+	groups := make(map[string][]numbered)
+	var prefixes []string
+	for _, seat := range seats {
+		prefix, num, ok := splitSeatName(seat.SeatName)
+		if !ok {
+			continue
+		}
+		if _, exists := groups[prefix]; !exists {
+			prefixes = append(prefixes, prefix)
+		}
+		groups[prefix] = append(groups[prefix], numbered{id: seat.SeatID, num: num})
+	}
+	sort.Strings(prefixes)
+
+	layout := &Layout{Positions: make(map[string]SeatPosition)}
+	rowOffset := 0
+	for _, prefix := range prefixes {
+		maxRow := -1
+		for _, s := range groups[prefix] {
+			idx := s.num - 1
+			if idx < 0 {
+				idx = 0
+			}
+			table := idx / rule.SeatsPerTable
+			inTable := idx % rule.SeatsPerTable
+			pos := SeatPosition{
+				Row:   rowOffset + (table/rule.TablesPerRow)*2 + inTable/perSide,
+				Col:   (table%rule.TablesPerRow)*perSide + inTable%perSide,
+				Table: fmt.Sprintf("%s%d", prefix, table+1),
+			}
+			layout.Positions[s.id] = pos
+			if pos.Row > maxRow {
+				maxRow = pos.Row
+			}
+		}
+		// 不同区域之间空一行
+		rowOffset = maxRow + 2
+	}
+	return layout
+}
+
+// LoadLayout 从 JSON 中载入布局，格式与 Layout 的 JSON 序列化结果一致，
+// 行列必须在 [0, 1000) 内
+func LoadLayout(r io.Reader) (*Layout, error) {
+	var layout Layout
+	if err := json.NewDecoder(r).Decode(&layout); err != nil {
+		return nil, fmt.Errorf("failed to decode layout: %w", err)
+	}
+	for id, pos := range layout.Positions {
+		if !pos.valid() {
+			return nil, fmt.Errorf("invalid position of seat %s: row %d, col %d", id, pos.Row, pos.Col)
+		}
+	}
+	if layout.Positions == nil {
+		layout.Positions = make(map[string]SeatPosition)
+	}
+	return &layout, nil
+}
+
+// Adjacent 判断两个座位是否相邻：同一张桌子，或同一排中紧挨着
+func (l *Layout) Adjacent(a, b string) bool {
+	pa, oka := l.Positions[a]
+	pb, okb := l.Positions[b]
+	if !oka || !okb || a == b {
+		return false
+	}
+	if pa.Table != "" && pa.Table == pb.Table {
+		return true
+	}
+	return pa.Row == pb.Row && absInt(pa.Col-pb.Col) == 1
+}
+
+// FindAdjacentFree 在 [startTime, endTime] 内整段空闲的座位中寻找 k 个连成一片的座位，
+// 优先选择占用桌子数量最少、彼此距离最近的一组
+func FindAdjacentFree(seats []Seat, layout *Layout, k int, startTime, endTime time.Time) ([]Seat, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("invalid group size: %d", k)
+	}
+
+	var free []Seat
+	for _, seat := range seats {
+		if _, ok := layout.Positions[seat.SeatID]; !ok {
+			continue
+		}
+		if isFree, _ := seat.IsFree(startTime, endTime); isFree {
+			free = append(free, seat)
+		}
+	}
+	sort.SliceStable(free, func(i, j int) bool {
+		return seatNameLess(free[i].SeatName, free[j].SeatName)
+	})
+
+	var (
+		best      []Seat
+		bestScore [2]int
+	)
+	for i := range free {
+		group := growGroup(free, layout, i, k)
+		if group == nil {
+			continue
+		}
+		score := groupScore(group, layout)
+		if best == nil || score[0] < bestScore[0] || (score[0] == bestScore[0] && score[1] < bestScore[1]) {
+			best, bestScore = group, score
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no %d adjacent free seats found", k)
+	}
+	return best, nil
+}
+
+// growGroup 从 free[start] 出发，每次加入与当前分组相邻且离起点最近的座位
+func growGroup(free []Seat, layout *Layout, start, k int) []Seat {
+	origin := layout.Positions[free[start].SeatID]
+	group := []Seat{free[start]}
+	used := map[int]bool{start: true}
+
+	for len(group) < k {
+		next := -1
+		nextDist := 0
+		for i, seat := range free {
+			if used[i] || !adjacentToGroup(layout, group, seat.SeatID) {
+				continue
+			}
+			pos := layout.Positions[seat.SeatID]
+			dist := absInt(pos.Row-origin.Row) + absInt(pos.Col-origin.Col)
+			if pos.Table != origin.Table {
+				// 同一张桌子的座位优先
+				dist += 100
+			}
+			if next == -1 || dist < nextDist {
+				next, nextDist = i, dist
+			}
+		}
+		if next == -1 {
+			return nil
+		}
+		used[next] = true
+		group = append(group, free[next])
+	}
+	return group
+}
+
+func adjacentToGroup(layout *Layout, group []Seat, seatID string) bool {
+	for _, s := range group {
+		if layout.Adjacent(s.SeatID, seatID) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupScore 返回 (桌子数量, 两两距离之和)，越小越好
+func groupScore(group []Seat, layout *Layout) [2]int {
+	tables := make(map[string]bool)
+	dist := 0
+	for i, a := range group {
+		pa := layout.Positions[a.SeatID]
+		tables[pa.Table] = true
+		for _, b := range group[i+1:] {
+			pb := layout.Positions[b.SeatID]
+			dist += absInt(pa.Row-pb.Row) + absInt(pa.Col-pb.Col)
+		}
+	}
+	return [2]int{len(tables), dist}
+}
+
+var seatNameRe = regexp.MustCompile(`^(.*?)(\d+)$`)
+
+// splitSeatName 把 "N1M-001" 拆分为前缀 "N1M-" 和编号 1
+func splitSeatName(name string) (string, int, bool) {
+	m := seatNameRe.FindStringSubmatch(name)
+	if m == nil {
+		return name, 0, false
+	}
+	num, err := strconv.Atoi(m[2])
+	if err != nil {
+		return name, 0, false
+	}
+	return m[1], num, true
+}
+
+func seatNameLess(a, b string) bool {
+	pa, na, oka := splitSeatName(a)
+	pb, nb, okb := splitSeatName(b)
+	if oka && okb && pa == pb {
+		return na < nb
+	}
+	return a < b
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,60 @@
+package library_reservation
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLayoutFromNames(t *testing.T) {
+	var seats []Seat
+	for _, name := range []string{"N1M-001", "N1M-002", "N1M-003", "N1M-004", "N1M-005", "N1M-021"} {
+		seats = append(seats, Seat{SeatID: name, SeatName: name})
+	}
+	layout := NewLayoutFromNames(seats, LayoutRule{SeatsPerTable: 4, TablesPerRow: 5})
+
+	cases := []struct {
+		a, b     string
+		adjacent bool
+	}{
+		{"N1M-001", "N1M-004", true},  // 同一张桌子
+		{"N1M-002", "N1M-005", true},  // 相邻桌子挨着的座位
+		{"N1M-001", "N1M-005", false}, // 相邻桌子但不挨着
+		{"N1M-001", "N1M-021", false}, // 下一排
+	}
+	for _, c := range cases {
+		if got := layout.Adjacent(c.a, c.b); got != c.adjacent {
+			t.Errorf("Adjacent(%s, %s) = %v, want %v", c.a, c.b, got, c.adjacent)
+		}
+	}
+}
+
+func TestFindAdjacentFree(t *testing.T) {
+	start := time.Now()
+	end := start.Add(time.Hour)
+
+	var seats []Seat
+	for i, name := range []string{"N2-001", "N2-003", "N2-005", "N2-006", "N2-007", "N2-009"} {
+		// N2-009 被占用
+		free := i != 5
+		seats = append(seats, NewSeat(name, name, "room", "room", start, end, free, nil))
+	}
+	layout := NewLayoutFromNames(seats, LayoutRule{})
+
+	group, err := FindAdjacentFree(seats, layout, 3, start, end)
+	if err != nil {
+		t.Fatalf("find failed: %v", err)
+	}
+	var names []string
+	for _, seat := range group {
+		names = append(names, seat.SeatName)
+	}
+	got := strings.Join(names, ",")
+	if got != "N2-005,N2-006,N2-007" {
+		t.Errorf("unexpected group %s", got)
+	}
+
+	if _, err := FindAdjacentFree(seats, layout, 6, start, end); err == nil {
+		t.Errorf("expected error when not enough adjacent seats")
+	}
+}
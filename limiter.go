@@ -0,0 +1,229 @@
+package library_reservation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Endpoint 图书馆系统中的接口，用于按接口限流
+type Endpoint string
+
+const (
+	EndpointDefault      Endpoint = "default"      // Default.aspx，获取 lt、execution 和 cookie
+	EndpointLogin        Endpoint = "login"        // CAS 登录
+	EndpointCaptcha      Endpoint = "captcha"      // CAS 验证码图片
+	EndpointSeats        Endpoint = "seats"        // device.aspx，查询座位
+	EndpointReserve      Endpoint = "reserve"      // reserve.aspx，预约座位
+	EndpointReservations Endpoint = "reservations" // center.aspx，查询预约记录
+	EndpointUserInfo     Endpoint = "user_info"    // login.aspx，登录后获取姓名，见 WithDisplayName
+)
+
+// RateLimit 令牌桶参数，Rate 为每秒补充的令牌数，Burst 为桶容量。Rate <= 0 表示不限制
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// LimiterConfig 限流配置，一次请求需要同时通过全局、学生和接口三个令牌桶，
+// 零值表示不做任何限制
+type LimiterConfig struct {
+	Global      RateLimit              // 所有请求共享
+	PerStudent  RateLimit              // 每个学生单独计算
+	PerEndpoint map[Endpoint]RateLimit // 每个接口单独计算，不在其中的接口不限制
+}
+
+// DefaultLimiterConfig 默认的限流配置，足够日常使用，又不会给图书馆系统带来明显压力
+func DefaultLimiterConfig() LimiterConfig {
+	return LimiterConfig{
+		Global:     RateLimit{Rate: 5, Burst: 10},
+		PerStudent: RateLimit{Rate: 1, Burst: 5},
+		PerEndpoint: map[Endpoint]RateLimit{
+			EndpointLogin:   {Rate: 0.2, Burst: 2},
+			EndpointReserve: {Rate: 1, Burst: 2},
+		},
+	}
+}
+
+type Limiter interface {
+	// Wait 阻塞直到 stuID 可以向 ep 发出一次请求，stuID 为空时不计入学生的令牌桶
+	Wait(ctx context.Context, stuID string, ep Endpoint) error
+	// Boost 在接下来的 d 时间内把每个令牌桶的容量提高 extra 并立即补充 extra 个令牌，
+	// 用于开放预约的那几秒集中抢座
+	Boost(extra int, d time.Duration)
+}
+
+// studentSweepInterval 多久清理一次空闲的学生令牌桶
+const studentSweepInterval = time.Minute
+
+// defaultLimiter 未通过 WithLimiter 指定时，所有 Auther 和 Reverser 共享的限流器
+var defaultLimiter = NewLimiter(DefaultLimiterConfig())
+
+type limiter struct {
+	mu  sync.Mutex
+	cfg LimiterConfig
+	now func() time.Time
+
+	global     *bucket
+	students   map[string]*bucket
+	endpoints  map[Endpoint]*bucket
+	boost      int
+	boostUntil time.Time
+	lastSweep  time.Time
+}
+
+func NewLimiter(cfg LimiterConfig) Limiter {
+	return &limiter{
+		cfg:       cfg,
+		now:       time.Now,
+		students:  make(map[string]*bucket),
+		endpoints: make(map[Endpoint]*bucket),
+	}
+}
+
+func (l *limiter) Wait(ctx context.Context, stuID string, ep Endpoint) error {
+	wait, taken := l.reserve(stuID, ep, l.now())
+	if wait <= 0 {
+		return nil
+	}
+	if !sleepCtx(ctx, wait) {
+		l.cancel(taken)
+		return fmt.Errorf("rate limit wait for %s interrupted: %w", ep, ctx.Err())
+	}
+	return nil
+}
+
+func (l *limiter) Boost(extra int, d time.Duration) {
+	if extra <= 0 || d <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.boost, l.boostUntil = extra, now.Add(d)
+	for _, b := range l.buckets() {
+		b.refill(now, l.extraAt(now))
+		b.tokens += float64(extra)
+	}
+}
+
+// reserve 从所有相关的令牌桶中各取一个令牌，返回需要等待的时间和取过令牌的桶。
+// 令牌不足时令牌数会变为负数，相当于预订了未来的令牌
+func (l *limiter) reserve(stuID string, ep Endpoint, now time.Time) (time.Duration, []*bucket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	extra := l.extraAt(now)
+	l.evictIdle(now, extra)
+	var (
+		wait  time.Duration
+		taken []*bucket
+	)
+	for _, b := range l.bucketsFor(stuID, ep, now, extra) {
+		b.refill(now, extra)
+		b.tokens--
+		taken = append(taken, b)
+		if b.tokens < 0 {
+			wait = max(wait, time.Duration(-b.tokens/b.rate*float64(time.Second)))
+		}
+	}
+	return wait, taken
+}
+
+// cancel 归还 reserve 取走的令牌
+func (l *limiter) cancel(taken []*bucket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, b := range taken {
+		b.tokens++
+	}
+}
+
+// evictIdle 定期删除已经补满的学生令牌桶。补满的令牌桶与新建的没有区别，删除后不影响限流，
+// 只是避免学生数量很多时 students 一直增长
+func (l *limiter) evictIdle(now time.Time, extra int) {
+	if now.Sub(l.lastSweep) < studentSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for stuID, b := range l.students {
+		b.refill(now, extra)
+		if b.tokens >= b.burst+float64(extra) {
+			delete(l.students, stuID)
+		}
+	}
+}
+
+func (l *limiter) extraAt(now time.Time) int {
+	if now.Before(l.boostUntil) {
+		return l.boost
+	}
+	return 0
+}
+
+// bucketsFor 返回一次请求涉及的令牌桶，不限制的级别不创建令牌桶
+func (l *limiter) bucketsFor(stuID string, ep Endpoint, now time.Time, extra int) []*bucket {
+	var res []*bucket
+	if l.cfg.Global.Rate > 0 {
+		if l.global == nil {
+			l.global = newBucket(l.cfg.Global, now, extra)
+		}
+		res = append(res, l.global)
+	}
+	if stuID != "" && l.cfg.PerStudent.Rate > 0 {
+		b, ok := l.students[stuID]
+		if !ok {
+			b = newBucket(l.cfg.PerStudent, now, extra)
+			l.students[stuID] = b
+		}
+		res = append(res, b)
+	}
+	if rl, ok := l.cfg.PerEndpoint[ep]; ok && rl.Rate > 0 {
+		b, ok := l.endpoints[ep]
+		if !ok {
+			b = newBucket(rl, now, extra)
+			l.endpoints[ep] = b
+		}
+		res = append(res, b)
+	}
+	return res
+}
+
+func (l *limiter) buckets() []*bucket {
+	var res []*bucket
+	if l.global != nil {
+		res = append(res, l.global)
+	}
+	for _, b := range l.students {
+		res = append(res, b)
+	}
+	for _, b := range l.endpoints {
+		res = append(res, b)
+	}
+	return res
+}
+
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newBucket 新建一个装满的令牌桶，extra 为 Boost 期间额外的容量
+func newBucket(rl RateLimit, now time.Time, extra int) *bucket {
+	burst := float64(max(rl.Burst, 1))
+	return &bucket{rate: rl.Rate, burst: burst, tokens: burst + float64(extra), last: now}
+}
+
+// refill 按流逝的时间补充令牌，容量为 burst+extra
+func (b *bucket) refill(now time.Time, extra int) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		b.last = now
+	}
+	b.tokens = math.Min(b.tokens, b.burst+float64(extra))
+}
@@ -0,0 +1,99 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterBuckets(t *testing.T) {
+	now := time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC)
+	l := NewLimiter(LimiterConfig{
+		Global:      RateLimit{Rate: 10, Burst: 3},
+		PerStudent:  RateLimit{Rate: 1, Burst: 1},
+		PerEndpoint: map[Endpoint]RateLimit{EndpointReserve: {Rate: 2, Burst: 1}},
+	}).(*limiter)
+	l.now = func() time.Time { return now }
+
+	if wait, _ := l.reserve("a", EndpointSeats, now); wait != 0 {
+		t.Fatalf("first request should not wait, got %v", wait)
+	}
+	// 学生 a 的令牌用完，需要等 1 秒
+	if wait, _ := l.reserve("a", EndpointSeats, now); wait != time.Second {
+		t.Errorf("expected per-student wait 1s, got %v", wait)
+	}
+	// 学生 b 不受 a 影响，但全局令牌已用完
+	if wait, _ := l.reserve("b", EndpointSeats, now); wait != 0 {
+		t.Errorf("expected no wait for another student, got %v", wait)
+	}
+	if wait, _ := l.reserve("c", EndpointSeats, now); wait != 100*time.Millisecond {
+		t.Errorf("expected global wait 100ms, got %v", wait)
+	}
+
+	// 接口限流与学生无关
+	now = now.Add(time.Minute)
+	if wait, _ := l.reserve("d", EndpointReserve, now); wait != 0 {
+		t.Errorf("first reserve should not wait, got %v", wait)
+	}
+	if wait, _ := l.reserve("e", EndpointReserve, now); wait != 500*time.Millisecond {
+		t.Errorf("expected endpoint wait 500ms, got %v", wait)
+	}
+
+	// Boost 后可以立即多发 2 个请求
+	now = now.Add(time.Minute)
+	l.Boost(2, 10*time.Second)
+	for i := 0; i < 3; i++ {
+		if wait, _ := l.reserve("f", EndpointSeats, now); wait != 0 {
+			t.Errorf("request %d during boost should not wait, got %v", i, wait)
+		}
+	}
+	// Boost 结束后容量恢复
+	now = now.Add(time.Minute)
+	l.reserve("g", EndpointSeats, now)
+	if wait, _ := l.reserve("g", EndpointSeats, now); wait != time.Second {
+		t.Errorf("expected capacity back to normal after boost, got %v", wait)
+	}
+}
+
+func TestLimiterWaitCancel(t *testing.T) {
+	l := NewLimiter(LimiterConfig{PerStudent: RateLimit{Rate: 0.01, Burst: 1}})
+	ctx := context.Background()
+	if err := l.Wait(ctx, "a", EndpointSeats); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, "a", EndpointSeats); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// 被取消的请求归还令牌，不会让后续请求等得更久
+	wait, _ := l.(*limiter).reserve("a", EndpointSeats, time.Now())
+	if wait > 100*time.Second {
+		t.Errorf("cancelled wait should return its token, got %v", wait)
+	}
+}
+
+func TestLimiterEvictIdle(t *testing.T) {
+	now := time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC)
+	// 每 30 秒补充一个令牌
+	l := NewLimiter(LimiterConfig{PerStudent: RateLimit{Rate: 1.0 / 30, Burst: 2}}).(*limiter)
+	l.now = func() time.Time { return now }
+
+	l.reserve("a", EndpointSeats, now)
+	for i := 0; i < 3; i++ {
+		l.reserve("c", EndpointSeats, now)
+	}
+
+	// 一分钟后 a 已经补满被删除，c 还欠着令牌，需要保留
+	now = now.Add(studentSweepInterval)
+	l.reserve("d", EndpointSeats, now)
+	if _, ok := l.students["a"]; ok || len(l.students) != 2 {
+		t.Errorf("expected only c and d to remain, got %v", l.students)
+	}
+	if wait, _ := l.reserve("c", EndpointSeats, now); wait != 0 {
+		t.Errorf("c should keep its refilled tokens, got wait %v", wait)
+	}
+}
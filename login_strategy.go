@@ -0,0 +1,164 @@
+package library_reservation
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+)
+
+// LoginStrategy 统一身份认证的登录方式。auther 负责获取登录页、提交表单、处理验证码和判断是否登录成功，
+// LoginStrategy 只负责根据页面生成要提交的表单
+//
+// page 是 parseLoginPage 从页面中取出的字段：所有隐藏字段（lt、execution、pwdEncryptSalt 等），
+// 以及 action、captchaField、captchaURL、mfaField
+type LoginStrategy interface {
+	// Name 登录方式的名称
+	Name() string
+	// Form 根据登录页生成登录表单
+	Form(ctx context.Context, stuID, pwd string, page map[string]string) (url.Values, error)
+	// Continue 提交登录表单后统一身份认证要求二次认证时，根据返回的页面生成下一步的表单，
+	// 不支持二次认证时返回 ErrMFARequired
+	Continue(ctx context.Context, stuID string, page map[string]string) (url.Values, error)
+}
+
+// MFAProvider 提供短信验证码、TOTP 等第二因素，例如从命令行读取用户输入。
+// 等待输入期间只阻塞该学生的登录，不影响其他学生的会话
+type MFAProvider func(ctx context.Context, stuID string) (string, error)
+
+type formLoginStrategy struct{}
+
+// FormLoginStrategy 明文提交学号、密码、lt 和 execution 的登录方式，也是默认的登录方式
+func FormLoginStrategy() LoginStrategy {
+	return formLoginStrategy{}
+}
+
+func (formLoginStrategy) Name() string {
+	return "form"
+}
+
+func (formLoginStrategy) Form(_ context.Context, stuID, pwd string, page map[string]string) (url.Values, error) {
+	if page["lt"] == "" || page["execution"] == "" {
+		return nil, fmt.Errorf("failed to find lt or execution in the response")
+	}
+	return url.Values{
+		"username":  {stuID},
+		"password":  {pwd},
+		"lt":        {page["lt"]},
+		"execution": {page["execution"]},
+		"_eventId":  {"submit"},
+		"submit":    {"登录"},
+	}, nil
+}
+
+func (formLoginStrategy) Continue(context.Context, string, map[string]string) (url.Values, error) {
+	return nil, &LoginError{Reason: ErrMFARequired, Message: "form login does not support second factor"}
+}
+
+type encryptedLoginStrategy struct {
+	mfa MFAProvider
+}
+
+// EncryptedLoginStrategy 新版统一身份认证的登录方式：密码用页面上的 pwdEncryptSalt 在客户端 AES 加密后提交，
+// 需要二次认证时通过 mfa 获取动态码，mfa 为 nil 时返回 ErrMFARequired
+func EncryptedLoginStrategy(mfa MFAProvider) LoginStrategy {
+	return &encryptedLoginStrategy{mfa: mfa}
+}
+
+func (s *encryptedLoginStrategy) Name() string {
+	return "encrypted"
+}
+
+func (s *encryptedLoginStrategy) Form(_ context.Context, stuID, pwd string, page map[string]string) (url.Values, error) {
+	salt := page["pwdEncryptSalt"]
+	if salt == "" {
+		return nil, fmt.Errorf("failed to find pwdEncryptSalt in the response")
+	}
+	if page["execution"] == "" {
+		return nil, fmt.Errorf("failed to find execution in the response")
+	}
+	encrypted, err := encryptPassword(pwd, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return url.Values{
+		"username":  {stuID},
+		"password":  {encrypted},
+		"execution": {page["execution"]},
+		"_eventId":  {"submit"},
+		"cllt":      {"userNameLogin"},
+		"dllt":      {"generalLogin"},
+		"lt":        {page["lt"]},
+	}, nil
+}
+
+func (s *encryptedLoginStrategy) Continue(ctx context.Context, stuID string, page map[string]string) (url.Values, error) {
+	field := page["mfaField"]
+	if s.mfa == nil || field == "" {
+		return nil, &LoginError{Reason: ErrMFARequired}
+	}
+	code, err := s.mfa(ctx, stuID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get second factor: %w", err)
+	}
+
+	form := url.Values{
+		field:      {code},
+		"_eventId": {"submit"},
+	}
+	// 带上页面上的隐藏字段，例如 execution
+	for _, key := range []string{"execution", "lt", "service"} {
+		if v := page[key]; v != "" {
+			form.Set(key, v)
+		}
+	}
+	return form, nil
+}
+
+// encryptChars 新版统一身份认证 encrypt.js 生成随机字符串所用的字符集
+const encryptChars = "ABCDEFGHJKMNPQRSTWXYZabcdefhijkmnprstwxyz2345678"
+
+// encryptPassword 与新版统一身份认证的 encrypt.js 一致：在密码前加 64 个随机字符，
+// 以 salt 为密钥、16 个随机字符为 IV 做 AES-CBC 加密（PKCS#7 填充），结果 base64 编码
+func encryptPassword(pwd, salt string) (string, error) {
+	block, err := aes.NewCipher([]byte(salt))
+	if err != nil {
+		return "", fmt.Errorf("invalid pwdEncryptSalt: %w", err)
+	}
+
+	prefix, err := randomString(64)
+	if err != nil {
+		return "", err
+	}
+	iv, err := randomString(aes.BlockSize)
+	if err != nil {
+		return "", err
+	}
+
+	plain := []byte(prefix + pwd)
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	plain = append(plain, bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, []byte(iv)).CryptBlocks(encrypted, plain)
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	limit := big.NewInt(int64(len(encryptChars)))
+	for i := range buf {
+		idx, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random string: %w", err)
+		}
+		buf[i] = encryptChars[idx.Int64()]
+	}
+	return string(buf), nil
+}
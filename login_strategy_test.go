@@ -0,0 +1,187 @@
+package library_reservation
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSalt = "rjBFAaHsNkKAhpoi"
+
+// decryptPassword 服务端的解密过程：IV 未知，所以丢弃第一个分组和随机前缀
+func decryptPassword(t *testing.T, encrypted string) string {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		t.Fatalf("invalid base64: %v", err)
+	}
+	block, _ := aes.NewCipher([]byte(testSalt))
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(plain, data)
+	plain = plain[:len(plain)-int(plain[len(plain)-1])]
+	return string(plain[64:])
+}
+
+func TestEncryptPassword(t *testing.T) {
+	a, err := encryptPassword("p@ss word", testSalt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := encryptPassword("p@ss word", testSalt)
+	if a == b {
+		t.Errorf("encryption should be randomized")
+	}
+	if got := decryptPassword(t, a); got != "p@ss word" {
+		t.Errorf("decrypted %q", got)
+	}
+	if _, err := encryptPassword("pwd", "short"); err == nil {
+		t.Errorf("expected error for invalid salt")
+	}
+}
+
+func TestEncryptedLoginWithMFA(t *testing.T) {
+	const loginPage = `<form id="pwdFromId" action="/authserver/login?service=x" method="post">
+<input id="username" name="username"/><input type="password" id="password" name="passwordText"/>
+<input type="hidden" id="pwdEncryptSalt" value="` + testSalt + `"/>
+<input type="hidden" name="execution" value="e1s1"/><input type="hidden" name="_eventId" value="submit"/></form>`
+	const mfaPage = `<form action="/authserver/reAuthCheck" method="post"><input name="dynamicCode"/>
+<input type="hidden" name="execution" value="e1s2"/></form>`
+
+	var steps []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/clientweb/xcus/ic2/Default.aspx", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: CookieKey1, Value: "sid", Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: CookieKey2, Value: "jsid", Path: "/"})
+		fmt.Fprint(w, loginPage)
+	})
+	mux.HandleFunc("/authserver/login", func(w http.ResponseWriter, r *http.Request) {
+		pwd := decryptPassword(t, r.FormValue("password"))
+		steps = append(steps, "login:"+r.FormValue("username")+":"+pwd+":"+r.FormValue("execution"))
+		fmt.Fprint(w, mfaPage)
+	})
+	mux.HandleFunc("/authserver/reAuthCheck", func(w http.ResponseWriter, r *http.Request) {
+		steps = append(steps, "mfa:"+r.FormValue("dynamicCode")+":"+r.FormValue("execution"))
+		http.Redirect(w, r, "/loginall.aspx?page=", http.StatusFound)
+	})
+	mux.HandleFunc("/loginall.aspx", func(w http.ResponseWriter, r *http.Request) {})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mfa := func(ctx context.Context, stuID string) (string, error) { return "123456", nil }
+	a := newTestAuther(srv, WithLoginStrategy(EncryptedLoginStrategy(mfa)))
+	cookie, err := a.GetCookie(context.Background(), "2023000001")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if cookie != CookieKey1+"=sid" {
+		t.Errorf("unexpected cookie %q", cookie)
+	}
+	want := "login:2023000001:pwd:e1s1 mfa:123456:e1s2"
+	if strings.Join(steps, " ") != want {
+		t.Errorf("unexpected steps %v", steps)
+	}
+
+	// 没有 MFAProvider 时返回 ErrMFARequired
+	steps = nil
+	a = newTestAuther(srv, WithLoginStrategy(EncryptedLoginStrategy(nil)))
+	if _, err := a.GetCookie(context.Background(), "2023000001"); !errors.Is(err, ErrMFARequired) {
+		t.Errorf("expected ErrMFARequired, got %v", err)
+	}
+}
+
+func TestEncryptedLoginRedirectToMFA(t *testing.T) {
+	const loginPage = `<form id="pwdFromId" action="/authserver/login" method="post">
+<input id="username" name="username"/><input type="password" id="password" name="passwordText"/>
+<input type="hidden" id="pwdEncryptSalt" value="` + testSalt + `"/>
+<input type="hidden" name="execution" value="e1s1"/></form>`
+	const mfaPage = `<form action="/authserver/reAuthCheck" method="post"><input name="dynamicCode"/>
+<input type="hidden" name="execution" value="e1s2"/></form>`
+
+	// kjyy 和新版统一身份认证在不同的地址，统一身份认证的地址不在 casURL 下
+	kjyy := http.NewServeMux()
+	kjyySrv := httptest.NewServer(kjyy)
+	defer kjyySrv.Close()
+	auth := http.NewServeMux()
+	authSrv := httptest.NewServer(auth)
+	defer authSrv.Close()
+
+	kjyy.HandleFunc("/clientweb/xcus/ic2/Default.aspx", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: CookieKey1, Value: "sid", Path: "/"})
+		http.Redirect(w, r, authSrv.URL+"/authserver/login", http.StatusFound)
+	})
+	kjyy.HandleFunc("/loginall.aspx", func(w http.ResponseWriter, r *http.Request) {})
+	auth.HandleFunc("/authserver/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			http.SetCookie(w, &http.Cookie{Name: CookieKey2, Value: "jsid", Path: "/"})
+			fmt.Fprint(w, loginPage)
+			return
+		}
+		// 密码正确，重定向到二次认证页面
+		http.Redirect(w, r, "/authserver/reAuthCheck", http.StatusFound)
+	})
+	auth.HandleFunc("/authserver/reAuthCheck", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, mfaPage)
+			return
+		}
+		http.Redirect(w, r, kjyySrv.URL+"/loginall.aspx?page=", http.StatusFound)
+	})
+
+	newAuther := func(mfa MFAProvider) Auther {
+		a := NewAuther(
+			WithBaseURLs(kjyySrv.URL, authSrv.URL+"/cas"),
+			WithLimiter(NewLimiter(LimiterConfig{})),
+			WithBreaker(NewBreaker(BreakerConfig{})),
+			WithLoginStrategy(EncryptedLoginStrategy(mfa)),
+		)
+		_ = a.StoreStuInfo(context.Background(), "2023000001", "pwd")
+		return a
+	}
+
+	if _, err := newAuther(nil).GetCookie(context.Background(), "2023000001"); !errors.Is(err, ErrMFARequired) {
+		t.Errorf("redirect to the MFA page must not count as success, got %v", err)
+	}
+
+	mfa := func(ctx context.Context, stuID string) (string, error) { return "123456", nil }
+	if _, err := newAuther(mfa).GetCookie(context.Background(), "2023000001"); err != nil {
+		t.Errorf("expected login with second factor to succeed, got %v", err)
+	}
+
+	// 等待动态码输入时，其他学生的会话不受影响
+	waiting, release := make(chan struct{}), make(chan struct{})
+	a := newAuther(func(ctx context.Context, stuID string) (string, error) {
+		close(waiting)
+		<-release
+		return "123456", nil
+	})
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.GetCookie(context.Background(), "2023000001")
+		done <- err
+	}()
+	<-waiting
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := a.(SessionStore).StoreSession(ctx, "2023000002", "ext"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetCookie(ctx, "2023000002"); err != nil {
+		t.Errorf("other students should not wait for the second factor, got %v", err)
+	}
+	if err := a.(SessionProvider).Invalidate(ctx, "2023000002"); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("expected ErrSessionExpired, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("expected the login waiting for the second factor to finish, got %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package library_reservation
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 指标名称
+const (
+	MetricOperationAttempts = "library_operation_attempts_total"    // 操作次数，标签 op
+	MetricOperationSuccess  = "library_operation_success_total"     // 成功次数，标签 op
+	MetricOperationFailures = "library_operation_failures_total"    // 失败次数，标签 op、error
+	MetricOperationDuration = "library_operation_duration_seconds"  // 耗时，标签 op
+	MetricCookieCache       = "library_cookie_cache_requests_total" // cookie 缓存命中情况，标签 result
+)
+
+// 操作名称，即指标的 op 标签
+const (
+	OpGetCookie        = "get_cookie"
+	OpGetNecessaryInfo = "get_necessary_info"
+	OpLogin            = "login"
+	OpGetSeats         = "get_seats"
+	OpReverse          = "reverse"
+)
+
+// Labels 指标的标签
+type Labels map[string]string
+
+// Metrics 指标的收集接口，可以对接 Prometheus 等监控系统
+type Metrics interface {
+	// IncCounter 计数器加一
+	IncCounter(name string, labels Labels)
+	// Observe 记录一次观测值，例如耗时（秒）
+	Observe(name string, labels Labels, value float64)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) IncCounter(string, Labels)       {}
+func (nopMetrics) Observe(string, Labels, float64) {}
+
+// DefaultBuckets 耗时直方图默认的分桶（秒）
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// MetricsRegistry 在内存中保存指标，并以 Prometheus 文本格式输出
+type MetricsRegistry interface {
+	Metrics
+	// WriteText 以 Prometheus 文本格式输出所有指标
+	WriteText(w io.Writer) error
+}
+
+type metricsRegistry struct {
+	mu         sync.Mutex
+	buckets    []float64
+	counters   map[string]map[string]float64 // name -> labels -> value
+	histograms map[string]map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // 与 buckets 一一对应，不累加
+	sum    float64
+	count  uint64
+}
+
+// NewMetricsRegistry 创建内存中的指标注册表，buckets 为空时使用 DefaultBuckets
+func NewMetricsRegistry(buckets ...float64) MetricsRegistry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &metricsRegistry{
+		buckets:    buckets,
+		counters:   make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+func (m *metricsRegistry) IncCounter(name string, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.counters[name]
+	if !ok {
+		series = make(map[string]float64)
+		m.counters[name] = series
+	}
+	series[formatLabels(labels)]++
+}
+
+func (m *metricsRegistry) Observe(name string, labels Labels, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.histograms[name]
+	if !ok {
+		series = make(map[string]*histogram)
+		m.histograms[name] = series
+	}
+	key := formatLabels(labels)
+	h, ok := series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		series[key] = h
+	}
+	for i, le := range m.buckets {
+		if value <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (m *metricsRegistry) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, name := range sortedKeys(m.counters) {
+		fmt.Fprintf(bw, "# TYPE %s counter\n", name)
+		series := m.counters[name]
+		for _, labels := range sortedKeys(series) {
+			fmt.Fprintf(bw, "%s%s %s\n", name, labels, formatFloat(series[labels]))
+		}
+	}
+	for _, name := range sortedKeys(m.histograms) {
+		fmt.Fprintf(bw, "# TYPE %s histogram\n", name)
+		series := m.histograms[name]
+		for _, labels := range sortedKeys(series) {
+			h := series[labels]
+			var cumulative uint64
+			for i, le := range m.buckets {
+				cumulative += h.counts[i]
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", name, withLabel(labels, "le", formatFloat(le)), cumulative)
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", name, withLabel(labels, "le", "+Inf"), h.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", name, labels, h.count)
+		}
+	}
+	return bw.Flush()
+}
+
+// MetricsHandler 返回输出 Prometheus 文本格式指标的 /metrics 处理函数
+func MetricsHandler(reg MetricsRegistry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := reg.WriteText(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// formatLabels 把标签格式化为 {a="1",b="2"}，按名称排序
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels))
+	for _, k := range sortedKeys(labels) {
+		parts = append(parts, k+"="+strconv.Quote(labels[k]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// withLabel 在已经格式化的标签后追加一个标签
+func withLabel(labels, k, v string) string {
+	label := k + "=" + strconv.Quote(v)
+	if labels == "" {
+		return "{" + label + "}"
+	}
+	return labels[:len(labels)-1] + "," + label + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// observe 记录一次操作的次数、结果和耗时
+func (o *options) observe(op string, start time.Time, err error) {
+	labels := Labels{"op": op}
+	o.metrics.IncCounter(MetricOperationAttempts, labels)
+	if err == nil {
+		o.metrics.IncCounter(MetricOperationSuccess, labels)
+	} else {
+		o.metrics.IncCounter(MetricOperationFailures, Labels{"op": op, "error": errorType(err)})
+	}
+	o.metrics.Observe(MetricOperationDuration, labels, time.Since(start).Seconds())
+}
+
+// errorType 把错误归类为指标的 error 标签，保证标签取值有限
+func errorType(err error) string {
+	var (
+		netErr  *NetworkError
+		httpErr *HTTPError
+	)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, ErrServiceUnavailable):
+		return "unavailable"
+	case errors.As(err, &netErr):
+		return "network"
+	case errors.As(err, &httpErr):
+		return fmt.Sprintf("http_%dxx", httpErr.StatusCode/100)
+	case errors.Is(err, ErrSessionExpired):
+		return "session_expired"
+	case errors.Is(err, ErrLoggedOut):
+		return "logged_out"
+	case errors.Is(err, ErrStudentNotFound):
+		return "student_not_found"
+	case errors.Is(err, ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.Is(err, ErrCaptchaRequired):
+		return "captcha_required"
+	case errors.Is(err, ErrAccountLocked):
+		return "account_locked"
+	case errors.Is(err, ErrMFARequired):
+		return "mfa_required"
+	case errors.Is(err, ErrPasswordChangeRequired):
+		return "password_change_required"
+	case errors.Is(err, ErrLoginFailed):
+		return "login_failed"
+	case errors.Is(err, ErrReverseRejected), errors.Is(err, ErrRequestRejected):
+		return "rejected"
+	case errors.Is(err, ErrNoAvailableSeat):
+		return "no_available_seat"
+	default:
+		return "other"
+	}
+}
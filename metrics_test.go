@@ -0,0 +1,77 @@
+package library_reservation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	reg := NewMetricsRegistry(0.1, 1)
+	reg.IncCounter("requests_total", Labels{"op": "a", "code": `x"y`})
+	reg.IncCounter("requests_total", Labels{"op": "a", "code": `x"y`})
+	reg.Observe("latency_seconds", Labels{"op": "a"}, 0.05)
+	reg.Observe("latency_seconds", Labels{"op": "a"}, 0.5)
+	reg.Observe("latency_seconds", Labels{"op": "a"}, 3)
+
+	var sb strings.Builder
+	if err := reg.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE requests_total counter
+requests_total{code="x\"y",op="a"} 2
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="a",le="0.1"} 1
+latency_seconds_bucket{op="a",le="1"} 2
+latency_seconds_bucket{op="a",le="+Inf"} 3
+latency_seconds_sum{op="a"} 3.55
+latency_seconds_count{op="a"} 3
+`
+	if sb.String() != want {
+		t.Errorf("unexpected exposition:\n%s", sb.String())
+	}
+}
+
+func TestReverserMetrics(t *testing.T) {
+	reg := NewMetricsRegistry()
+	r := newTestReverser(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.URL.Path, "reserve.aspx") {
+			fmt.Fprint(w, `{"ret":0,"msg":"该时间段已被预约"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ret":1,"data":[]}`)
+	}), WithMetrics(reg), WithRetryPolicy(NoRetry()))
+
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 8, 0)
+	if _, err := r.GetSeatsByTime(context.Background(), "a", "101", start, start.Add(time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Reverse(context.Background(), "a", "101", start, start.Add(time.Hour))
+
+	srv := httptest.NewServer(MetricsHandler(reg))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, line := range []string{
+		`library_operation_success_total{op="get_seats"} 1`,
+		`library_operation_attempts_total{op="reverse"} 1`,
+		`library_operation_failures_total{error="rejected",op="reverse"} 1`,
+		`library_operation_duration_seconds_count{op="get_seats"} 1`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package library_reservation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NotificationKind 通知的类型
+type NotificationKind string
+
+const (
+	NotifyReverseSuccess  NotificationKind = "reverse_success"   // 预约成功
+	NotifyReverseFailure  NotificationKind = "reverse_failure"   // 预约失败
+	NotifyCheckInDeadline NotificationKind = "check_in_deadline" // 即将到达签到截止时间
+	NotifyLoginFailure    NotificationKind = "login_failure"     // 登录失败
+)
+
+// Notification 一条需要发送的通知
+type Notification struct {
+	Kind      NotificationKind `json:"kind"`
+	StuID     string           `json:"stuId"`
+	SeatID    string           `json:"seatId,omitempty"`
+	StartTime time.Time        `json:"startTime,omitzero"`
+	EndTime   time.Time        `json:"endTime,omitzero"`
+	Deadline  time.Time        `json:"deadline,omitzero"` // 签到截止时间，仅 NotifyCheckInDeadline 时有值
+	Err       string           `json:"error,omitempty"`
+	At        time.Time        `json:"at"`
+}
+
+// Title 通知标题
+func (n Notification) Title() string {
+	switch n.Kind {
+	case NotifyReverseSuccess:
+		return "座位预约成功"
+	case NotifyReverseFailure:
+		return "座位预约失败"
+	case NotifyCheckInDeadline:
+		return "签到提醒"
+	case NotifyLoginFailure:
+		return "登录失败"
+	default:
+		return string(n.Kind)
+	}
+}
+
+// Text 通知正文
+func (n Notification) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "学号: %s\n", n.StuID)
+	if n.SeatID != "" {
+		fmt.Fprintf(&b, "座位: %s\n", n.SeatID)
+	}
+	if !n.StartTime.IsZero() {
+		fmt.Fprintf(&b, "时间: %s - %s\n", n.StartTime.Format("2006-01-02 15:04"), n.EndTime.Format("15:04"))
+	}
+	if !n.Deadline.IsZero() {
+		fmt.Fprintf(&b, "签到截止: %s\n", n.Deadline.Format("2006-01-02 15:04"))
+	}
+	if n.Err != "" {
+		fmt.Fprintf(&b, "原因: %s\n", n.Err)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// MultiNotifier 依次发送到多个通知渠道，返回所有失败的错误
+type MultiNotifier []Notifier
+
+func (m MultiNotifier) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type nopNotifier struct{}
+
+func (nopNotifier) Notify(context.Context, Notification) error { return nil }
+
+// webhookNotifier 把 Notification 以 JSON 的形式 POST 到指定地址
+type webhookNotifier struct {
+	cli *http.Client
+	url string
+}
+
+func NewWebhookNotifier(url string) Notifier {
+	return &webhookNotifier{cli: http.DefaultClient, url: url}
+}
+
+func (w *webhookNotifier) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, w.cli, w.url, n, nil)
+}
+
+// serverChanNotifier Server酱 https://sct.ftqq.com
+type serverChanNotifier struct {
+	cli *http.Client
+	url string
+}
+
+func NewServerChanNotifier(sendKey string) Notifier {
+	return &serverChanNotifier{
+		cli: http.DefaultClient,
+		url: fmt.Sprintf("https://sctapi.ftqq.com/%s.send", sendKey),
+	}
+}
+
+func (s *serverChanNotifier) Notify(ctx context.Context, n Notification) error {
+	form := url.Values{
+		"title": {n.Title()},
+		"desp":  {n.Text()},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := doJSON(s.cli, req, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("serverchan returned code %d: %s", resp.Code, resp.Message)
+	}
+	return nil
+}
+
+// dingTalkNotifier 钉钉自定义机器人，secret 为空表示未开启加签
+type dingTalkNotifier struct {
+	cli     *http.Client
+	webhook string
+	secret  string
+}
+
+func NewDingTalkNotifier(webhook, secret string) Notifier {
+	return &dingTalkNotifier{cli: http.DefaultClient, webhook: webhook, secret: secret}
+}
+
+func (d *dingTalkNotifier) Notify(ctx context.Context, n Notification) error {
+	target := d.webhook
+	if d.secret != "" {
+		ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		sign := hmacSign(d.secret, ts+"\n"+d.secret)
+		u, err := url.Parse(d.webhook)
+		if err != nil {
+			return fmt.Errorf("invalid webhook: %w", err)
+		}
+		q := u.Query()
+		q.Set("timestamp", ts)
+		q.Set("sign", sign)
+		u.RawQuery = q.Encode()
+		target = u.String()
+	}
+
+	body := map[string]any{
+		"msgtype": "text",
+		"text":    map[string]string{"content": n.Title() + "\n" + n.Text()},
+	}
+	var resp struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := postJSON(ctx, d.cli, target, body, &resp); err != nil {
+		return err
+	}
+	if resp.ErrCode != 0 {
+		return fmt.Errorf("dingtalk returned code %d: %s", resp.ErrCode, resp.ErrMsg)
+	}
+	return nil
+}
+
+// feishuNotifier 飞书自定义机器人，secret 为空表示未开启签名校验
+type feishuNotifier struct {
+	cli     *http.Client
+	webhook string
+	secret  string
+}
+
+func NewFeishuNotifier(webhook, secret string) Notifier {
+	return &feishuNotifier{cli: http.DefaultClient, webhook: webhook, secret: secret}
+}
+
+func (f *feishuNotifier) Notify(ctx context.Context, n Notification) error {
+	body := map[string]any{
+		"msg_type": "text",
+		"content":  map[string]string{"text": n.Title() + "\n" + n.Text()},
+	}
+	if f.secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		// 飞书以 timestamp + "\n" + secret 作为密钥对空串签名
+		body["timestamp"] = ts
+		body["sign"] = hmacSign(ts+"\n"+f.secret, "")
+	}
+	var resp struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := postJSON(ctx, f.cli, f.webhook, body, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("feishu returned code %d: %s", resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+// SMTPConfig 邮件通知的配置
+type SMTPConfig struct {
+	Host     string // 例如 smtp.qq.com
+	Port     int    // 例如 587
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+type emailNotifier struct {
+	cfg      SMTPConfig
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewEmailNotifier(cfg SMTPConfig) Notifier {
+	return &emailNotifier{cfg: cfg, sendMail: smtp.SendMail}
+}
+
+func (e *emailNotifier) Notify(ctx context.Context, n Notification) error {
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		auth = smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)
+	}
+	addr := fmt.Sprintf("%s:%d", e.cfg.Host, e.cfg.Port)
+	if err := e.sendMail(addr, auth, e.cfg.From, e.cfg.To, buildMail(e.cfg.From, e.cfg.To, n)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+func buildMail(from string, to []string, n Notification) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: =?UTF-8?B?%s?=\r\n", base64.StdEncoding.EncodeToString([]byte(n.Title())))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	b.WriteString(base64.StdEncoding.EncodeToString([]byte(n.Text())))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+func hmacSign(key, data string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func postJSON(ctx context.Context, cli *http.Client, target string, body any, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal body: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doJSON(cli, req, out)
+}
+
+// doJSON 发送请求并检查状态码，out 不为 nil 时把响应解析到 out 中
+func doJSON(cli *http.Client, req *http.Request, out any) error {
+	resp, err := cli.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	bodyText, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if err := json.Unmarshal(bodyText, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package library_reservation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var got Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	n := Notification{Kind: NotifyReverseSuccess, StuID: "2023000001", SeatID: "101"}
+	if err := NewWebhookNotifier(srv.URL).Notify(context.Background(), n); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if got.Kind != NotifyReverseSuccess || got.SeatID != "101" {
+		t.Errorf("unexpected payload: %+v", got)
+	}
+}
+
+func TestBotNotifiers(t *testing.T) {
+	var (
+		body  map[string]any
+		query string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		data, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") == "application/json" {
+			body = nil
+			_ = json.Unmarshal(data, &body)
+		} else {
+			body = map[string]any{"form": string(data)}
+		}
+		_, _ = w.Write([]byte(`{"code":0,"errcode":0}`))
+	}))
+	defer srv.Close()
+
+	n := Notification{Kind: NotifyLoginFailure, StuID: "2023000001", Err: "bad password"}
+	ctx := context.Background()
+
+	if err := NewDingTalkNotifier(srv.URL, "secret").Notify(ctx, n); err != nil {
+		t.Fatalf("dingtalk notify failed: %v", err)
+	}
+	if body["msgtype"] != "text" || !strings.Contains(query, "sign=") {
+		t.Errorf("unexpected dingtalk request: %v %s", body, query)
+	}
+
+	if err := NewFeishuNotifier(srv.URL, "secret").Notify(ctx, n); err != nil {
+		t.Fatalf("feishu notify failed: %v", err)
+	}
+	if body["msg_type"] != "text" || body["sign"] == nil {
+		t.Errorf("unexpected feishu request: %v", body)
+	}
+
+	sc := &serverChanNotifier{cli: http.DefaultClient, url: srv.URL}
+	if err := sc.Notify(ctx, n); err != nil {
+		t.Fatalf("serverchan notify failed: %v", err)
+	}
+	if form, _ := body["form"].(string); !strings.Contains(form, "desp=") {
+		t.Errorf("unexpected serverchan request: %v", body)
+	}
+}
+
+func TestBotNotifierError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":310000,"errmsg":"sign not match"}`))
+	}))
+	defer srv.Close()
+
+	err := NewDingTalkNotifier(srv.URL, "").Notify(context.Background(), Notification{Kind: NotifyReverseFailure})
+	if err == nil || !strings.Contains(err.Error(), "sign not match") {
+		t.Errorf("expected dingtalk error, got %v", err)
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	var msg string
+	e := &emailNotifier{
+		cfg: SMTPConfig{Host: "localhost", Port: 25, From: "a@example.com", To: []string{"b@example.com"}},
+		sendMail: func(addr string, a smtp.Auth, from string, to []string, m []byte) error {
+			msg = string(m)
+			return nil
+		},
+	}
+	if err := e.Notify(context.Background(), Notification{Kind: NotifyCheckInDeadline, StuID: "1"}); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if !strings.Contains(msg, "To: b@example.com") || !strings.Contains(msg, "Subject: =?UTF-8?B?") {
+		t.Errorf("unexpected mail: %q", msg)
+	}
+}
+
+type failNotifier struct{}
+
+func (failNotifier) Notify(context.Context, Notification) error {
+	return errors.New("webhook down")
+}
+
+func TestNotifyFailureWarning(t *testing.T) {
+	var warnings []error
+	r := newTestReverser(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"ret":1}`))
+	}), WithNotifier(failNotifier{}), WithWarningHandler(func(err error) { warnings = append(warnings, err) }))
+
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 14, 0)
+	if err := r.Reverse(context.Background(), "a", "101", start, start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), "webhook down") {
+		t.Errorf("expected the notification failure to be reported as a warning, got %v", warnings)
+	}
+}
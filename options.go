@@ -0,0 +1,252 @@
+package library_reservation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type options struct {
+	notifier  Notifier
+	onWarning func(error)
+	limiter   Limiter
+	retry     RetryPolicy
+	breaker   Breaker
+	metrics   Metrics
+	tracer    Tracer
+	traceSalt string
+	timeouts  Timeouts
+	kjyyURL   string
+	casURL    string
+	captcha   CaptchaSolver
+	login     LoginStrategy
+
+	displayName  bool
+	deviceStatus func(devsta, runsta int) DeviceStatus
+}
+
+const (
+	DefaultKJYYBaseURL = "http://kjyy.ccnu.edu.cn"
+	DefaultCASBaseURL  = "https://account.ccnu.edu.cn/cas"
+)
+
+// Timeouts 每个操作单次尝试的默认超时时间，ctx 的截止时间更早时以 ctx 为准
+type Timeouts struct {
+	GetCookie       time.Duration // 登录，包括获取 lt、execution，默认 30 秒
+	GetSeats        time.Duration // 查询座位，默认 15 秒
+	Reverse         time.Duration // 预约座位，默认 10 秒
+	GetReservations time.Duration // 查询预约记录，默认 15 秒
+	Notify          time.Duration // 发送通知，默认 10 秒。通知不受调用方 ctx 取消的影响
+}
+
+// Option 用于配置 NewAuther 和 NewReverser，同一组 Option 可以同时传给两者
+type Option func(*options)
+
+// WithNotifier 设置预约结果、登录失败等事件的通知渠道
+func WithNotifier(n Notifier) Option {
+	return func(o *options) {
+		if n != nil {
+			o.notifier = n
+		}
+	}
+}
+
+// WithWarningHandler 设置非致命问题（例如无法解析的占用记录、通知发送失败）的处理函数，默认用 log 输出到标准错误
+func WithWarningHandler(fn func(error)) Option {
+	return func(o *options) {
+		if fn != nil {
+			o.onWarning = fn
+		}
+	}
+}
+
+// WithLimiter 设置请求限流器，默认使用所有实例共享的 DefaultLimiterConfig 限流器。
+// 传入 NewLimiter(LimiterConfig{}) 可以关闭限流
+func WithLimiter(l Limiter) Option {
+	return func(o *options) {
+		if l != nil {
+			o.limiter = l
+		}
+	}
+}
+
+// WithRetryPolicy 设置查询座位、预约等请求失败后的重试策略，默认为 DefaultRetryPolicy
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = p
+	}
+}
+
+// WithBreaker 设置熔断器，默认使用所有实例共享的熔断器
+func WithBreaker(b Breaker) Option {
+	return func(o *options) {
+		if b != nil {
+			o.breaker = b
+		}
+	}
+}
+
+// WithMetrics 设置指标收集，例如 NewMetricsRegistry()
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		if m != nil {
+			o.metrics = m
+		}
+	}
+}
+
+// WithTracer 设置 tracing，每个操作和每次 HTTP 请求（包括重定向）都会创建 span。
+// salt 用于计算 span 上的学号哈希 student.hash，学号的取值范围很小，不加盐的哈希可以被穷举还原，
+// 所以 salt 为空时不记录学号哈希
+func WithTracer(t Tracer, salt string) Option {
+	return func(o *options) {
+		if t != nil {
+			o.tracer = t
+			o.traceSalt = salt
+		}
+	}
+}
+
+// WithTimeouts 设置每个操作的默认超时时间，为 0 的字段保持默认值
+func WithTimeouts(t Timeouts) Option {
+	return func(o *options) {
+		if t.GetCookie > 0 {
+			o.timeouts.GetCookie = t.GetCookie
+		}
+		if t.GetSeats > 0 {
+			o.timeouts.GetSeats = t.GetSeats
+		}
+		if t.Reverse > 0 {
+			o.timeouts.Reverse = t.Reverse
+		}
+		if t.GetReservations > 0 {
+			o.timeouts.GetReservations = t.GetReservations
+		}
+		if t.Notify > 0 {
+			o.timeouts.Notify = t.Notify
+		}
+	}
+}
+
+// WithBaseURLs 设置 kjyy 和统一身份认证的地址，主要用于测试，为空时保持默认值
+func WithBaseURLs(kjyy, cas string) Option {
+	return func(o *options) {
+		if kjyy != "" {
+			o.kjyyURL = strings.TrimSuffix(kjyy, "/")
+		}
+		if cas != "" {
+			o.casURL = strings.TrimSuffix(cas, "/")
+		}
+	}
+}
+
+// WithCaptchaSolver 设置统一身份认证要求输入验证码时的识别方式，未设置时返回 ErrCaptchaRequired
+func WithCaptchaSolver(s CaptchaSolver) Option {
+	return func(o *options) {
+		if s != nil {
+			o.captcha = s
+		}
+	}
+}
+
+// WithLoginStrategy 设置统一身份认证的登录方式，默认为 FormLoginStrategy
+func WithLoginStrategy(s LoginStrategy) Option {
+	return func(o *options) {
+		if s != nil {
+			o.login = s
+		}
+	}
+}
+
+// WithDisplayName 登录后额外请求一次图书馆系统，获取 Session.DisplayName，默认不获取。
+// 该请求失败不影响登录，也不计入熔断
+func WithDisplayName() Option {
+	return func(o *options) {
+		o.displayName = true
+	}
+}
+
+// WithDeviceStatusMapping 设置由 devsta、runsta 得到 SeatDetails.Status 的规则。
+// 默认只把确认过的 devsta 为 1 映射为 DeviceNormal，其它值为 DeviceUnknown，InService 无法过滤掉它们；
+// 确认了维护、停用对应的取值后可以通过这里映射为 DeviceMaintenance、DeviceOutOfService
+func WithDeviceStatusMapping(fn func(devsta, runsta int) DeviceStatus) Option {
+	return func(o *options) {
+		if fn != nil {
+			o.deviceStatus = fn
+		}
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		notifier: nopNotifier{},
+		limiter:  defaultLimiter,
+		retry:    DefaultRetryPolicy(),
+		breaker:  defaultBreaker,
+		metrics:  nopMetrics{},
+		tracer:   nopTracer{},
+		timeouts: Timeouts{
+			GetCookie:       30 * time.Second,
+			GetSeats:        15 * time.Second,
+			Reverse:         10 * time.Second,
+			GetReservations: 15 * time.Second,
+			Notify:          10 * time.Second,
+		},
+		login:   FormLoginStrategy(),
+		kjyyURL: DefaultKJYYBaseURL,
+		casURL:  DefaultCASBaseURL,
+		onWarning: func(err error) {
+			log.Println("warning:", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// notify 发送通知，失败时交给 WithWarningHandler 处理，不影响主流程。调用方的 ctx 可能已经超时或被取消（例如预约失败的原因就是超时），
+// 所以只保留其中的值，另外使用 Timeouts.Notify 作为超时。调用时不能持有锁
+func (o *options) notify(ctx context.Context, n Notification) {
+	if n.At.IsZero() {
+		n.At = time.Now()
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.timeouts.Notify)
+	defer cancel()
+	if err := o.notifier.Notify(ctx, n); err != nil {
+		o.onWarning(fmt.Errorf("failed to send notification: %w", err))
+	}
+}
+
+// do 发送一次对图书馆系统的请求，所有 HTTP 请求都应经过这里。
+// 网络错误返回 *NetworkError，4xx、5xx 状态码返回 *HTTPError，服务熔断时返回 ErrServiceUnavailable
+func (o *options) do(cli *http.Client, stuID string, ep Endpoint, req *http.Request) (*http.Response, error) {
+	if err := o.limiter.Wait(req.Context(), stuID, ep); err != nil {
+		return nil, err
+	}
+	done := func(error) {}
+	if ep.bestEffort() {
+		// 可有可无的请求不计入熔断，服务不正常时直接放弃
+		if o.breaker.State(ep.Service()) != BreakerClosed {
+			return nil, ErrServiceUnavailable
+		}
+	} else {
+		var err error
+		if done, err = o.breaker.Allow(ep.Service()); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := cli.Do(req)
+	if err != nil {
+		err = &NetworkError{Endpoint: ep, Err: err}
+	} else if resp.StatusCode >= http.StatusBadRequest {
+		resp.Body.Close()
+		resp, err = nil, &HTTPError{Endpoint: ep, StatusCode: resp.StatusCode}
+	}
+	done(err)
+	return resp, err
+}
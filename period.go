@@ -0,0 +1,174 @@
+package library_reservation
+
+import (
+	"sort"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+// 以下是 Period 的区间运算，所有 Period 均视为左闭右开区间 [StartTime, EndTime)，
+// 长度为 0 的区间视为空区间
+
+// Duration 区间长度，无效区间返回 0
+func (p Period) Duration() time.Duration {
+	if !p.StartTime.Before(p.EndTime) {
+		return 0
+	}
+	return p.EndTime.Sub(p.StartTime)
+}
+
+// IsEmpty 区间是否为空
+func (p Period) IsEmpty() bool {
+	return !p.StartTime.Before(p.EndTime)
+}
+
+// Contains 判断 other 是否完全落在 p 内
+func (p Period) Contains(other Period) bool {
+	return !other.StartTime.Before(p.StartTime) && !other.EndTime.After(p.EndTime)
+}
+
+// ContainsTime 判断时间点 t 是否落在 p 内
+func (p Period) ContainsTime(t time.Time) bool {
+	return !t.Before(p.StartTime) && t.Before(p.EndTime)
+}
+
+// Overlaps 判断两个区间是否有长度大于 0 的重叠，首尾相接不算重叠
+func (p Period) Overlaps(other Period) bool {
+	return p.StartTime.Before(other.EndTime) && other.StartTime.Before(p.EndTime)
+}
+
+// Intersect 返回两个区间的交集，没有交集时第二个返回值为 false。
+// 结果沿用 a 的 Owner
+func Intersect(a, b Period) (Period, bool) {
+	res := Period{
+		Owner:     a.Owner,
+		StartTime: pkg.MaxTime(a.StartTime, b.StartTime),
+		EndTime:   pkg.MinTime(a.EndTime, b.EndTime),
+	}
+	if res.IsEmpty() {
+		return Period{}, false
+	}
+	return res, true
+}
+
+// IntersectAll 返回两组区间的交集，结果有序且互不重叠
+func IntersectAll(a, b []Period) []Period {
+	a, b = Merge(a), Merge(b)
+	var res []Period
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if p, ok := Intersect(a[i], b[j]); ok {
+			res = append(res, p)
+		}
+		if a[i].EndTime.Before(b[j].EndTime) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return res
+}
+
+// Merge 排序并合并重叠或首尾相接的区间，丢弃空区间。
+// 合并后的区间只有在所有来源的 Owner 相同时才保留 Owner
+func Merge(ps []Period) []Period {
+	return merge(ps, true)
+}
+
+// merge 实现 Merge，touching 为 false 时首尾相接的区间保持分开，例如两个相邻的预约
+func merge(ps []Period, touching bool) []Period {
+	sorted := make([]Period, 0, len(ps))
+	for _, p := range ps {
+		if !p.IsEmpty() {
+			sorted = append(sorted, p)
+		}
+	}
+	sortPeriods(sorted)
+
+	var res []Period
+	for _, p := range sorted {
+		if n := len(res); n > 0 && (p.StartTime.Before(res[n-1].EndTime) || touching && p.StartTime.Equal(res[n-1].EndTime)) {
+			last := &res[n-1]
+			last.EndTime = pkg.MaxTime(last.EndTime, p.EndTime)
+			if last.Owner != p.Owner {
+				last.Owner = ""
+			}
+			continue
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+// Union 返回两组区间的并集
+func Union(a, b []Period) []Period {
+	all := make([]Period, 0, len(a)+len(b))
+	all = append(all, a...)
+	all = append(all, b...)
+	return Merge(all)
+}
+
+// Subtract 返回 a 中没有被 b 覆盖的部分
+func Subtract(a, b []Period) []Period {
+	a, b = Merge(a), Merge(b)
+	var res []Period
+	j := 0
+	for _, p := range a {
+		curr := p.StartTime
+		for j < len(b) && !b[j].EndTime.After(curr) {
+			j++
+		}
+		for k := j; k < len(b) && b[k].StartTime.Before(p.EndTime); k++ {
+			if curr.Before(b[k].StartTime) {
+				res = append(res, Period{Owner: p.Owner, StartTime: curr, EndTime: b[k].StartTime})
+			}
+			curr = pkg.MaxTime(curr, b[k].EndTime)
+		}
+		if curr.Before(p.EndTime) {
+			res = append(res, Period{Owner: p.Owner, StartTime: curr, EndTime: p.EndTime})
+		}
+	}
+	return res
+}
+
+// Gaps 返回 bound 内没有被 ps 覆盖的时间段
+func Gaps(ps []Period, bound Period) []Period {
+	if bound.IsEmpty() {
+		return nil
+	}
+	bound.Owner = ""
+	return Subtract([]Period{bound}, ps)
+}
+
+// LongestFree 返回 bound 内没有被 ps 覆盖的最长时间段，长度相同时取较早的一段
+func LongestFree(ps []Period, bound Period) (Period, bool) {
+	var (
+		best  Period
+		found bool
+	)
+	for _, gap := range Gaps(ps, bound) {
+		if !found || gap.Duration() > best.Duration() {
+			best, found = gap, true
+		}
+	}
+	return best, found
+}
+
+// TotalDuration 返回一组区间覆盖的总时长，重叠部分只计算一次
+func TotalDuration(ps []Period) time.Duration {
+	var total time.Duration
+	for _, p := range Merge(ps) {
+		total += p.Duration()
+	}
+	return total
+}
+
+func sortPeriods(ps []Period) {
+	sort.Slice(ps, func(i, j int) bool {
+		if ps[i].StartTime.Equal(ps[j].StartTime) {
+			return ps[i].EndTime.Before(ps[j].EndTime)
+		}
+		return ps[i].StartTime.Before(ps[j].StartTime)
+	})
+}
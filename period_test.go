@@ -0,0 +1,124 @@
+package library_reservation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+// hm 构造 2025-06-01 当天 h:m 的时间
+func hm(h, m int) time.Time {
+	return pkg.CreateShanghaiTime(2025, 6, 1, h, m)
+}
+
+func pd(sh, sm, eh, em int) Period {
+	return Period{StartTime: hm(sh, sm), EndTime: hm(eh, em)}
+}
+
+func TestMerge(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []Period
+		want []Period
+	}{
+		{"empty", nil, nil},
+		{"unsorted", []Period{pd(10, 0, 11, 0), pd(8, 0, 9, 0)}, []Period{pd(8, 0, 9, 0), pd(10, 0, 11, 0)}},
+		{"overlap", []Period{pd(8, 0, 10, 0), pd(9, 0, 11, 0)}, []Period{pd(8, 0, 11, 0)}},
+		{"touching", []Period{pd(8, 0, 9, 0), pd(9, 0, 10, 0)}, []Period{pd(8, 0, 10, 0)}},
+		{"nested", []Period{pd(8, 0, 12, 0), pd(9, 0, 10, 0)}, []Period{pd(8, 0, 12, 0)}},
+		{"drop empty", []Period{pd(8, 0, 8, 0), pd(10, 0, 9, 0)}, nil},
+	}
+	for _, c := range cases {
+		if got := Merge(c.in); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: Merge() = %v, want %v", c.name, got, c.want)
+		}
+	}
+	// 占用记录首尾相接时属于不同的预约，不合并
+	touching := []Period{pd(9, 0, 10, 0), pd(8, 0, 9, 0)}
+	if got := merge(touching, false); !reflect.DeepEqual(got, []Period{pd(8, 0, 9, 0), pd(9, 0, 10, 0)}) {
+		t.Errorf("merge(touching, false) = %v, want them kept apart", got)
+	}
+}
+
+func TestMergeOwner(t *testing.T) {
+	a := Period{Owner: "a", StartTime: hm(8, 0), EndTime: hm(9, 0)}
+	b := Period{Owner: "b", StartTime: hm(8, 30), EndTime: hm(10, 0)}
+	if got := Merge([]Period{a, b}); len(got) != 1 || got[0].Owner != "" {
+		t.Errorf("owner of merged period from different owners should be empty, got %v", got)
+	}
+	a2 := a
+	a2.StartTime, a2.EndTime = hm(9, 0), hm(10, 0)
+	if got := Merge([]Period{a, a2}); len(got) != 1 || got[0].Owner != "a" {
+		t.Errorf("owner should be kept, got %v", got)
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	if got, ok := Intersect(pd(8, 0, 10, 0), pd(9, 0, 11, 0)); !ok || !reflect.DeepEqual(got, pd(9, 0, 10, 0)) {
+		t.Errorf("Intersect overlap = %v, %v", got, ok)
+	}
+	if _, ok := Intersect(pd(8, 0, 9, 0), pd(9, 0, 10, 0)); ok {
+		t.Errorf("touching periods should not intersect")
+	}
+
+	got := IntersectAll([]Period{pd(8, 0, 10, 0), pd(12, 0, 14, 0)}, []Period{pd(9, 0, 13, 0)})
+	want := []Period{pd(9, 0, 10, 0), pd(12, 0, 13, 0)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("IntersectAll() = %v, want %v", got, want)
+	}
+}
+
+func TestSubtractAndUnion(t *testing.T) {
+	a := []Period{pd(8, 0, 12, 0), pd(14, 0, 18, 0)}
+	b := []Period{pd(9, 0, 10, 0), pd(11, 0, 15, 0), pd(17, 0, 19, 0)}
+
+	got := Subtract(a, b)
+	want := []Period{pd(8, 0, 9, 0), pd(10, 0, 11, 0), pd(15, 0, 17, 0)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Subtract() = %v, want %v", got, want)
+	}
+
+	got = Union(a, b)
+	want = []Period{pd(8, 0, 19, 0)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Union() = %v, want %v", got, want)
+	}
+}
+
+func TestGapsAndLongestFree(t *testing.T) {
+	bound := pd(8, 0, 22, 0)
+	occupied := []Period{pd(12, 0, 13, 0), pd(7, 0, 9, 0), pd(18, 0, 23, 0)}
+
+	got := Gaps(occupied, bound)
+	want := []Period{pd(9, 0, 12, 0), pd(13, 0, 18, 0)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Gaps() = %v, want %v", got, want)
+	}
+
+	longest, ok := LongestFree(occupied, bound)
+	if !ok || !reflect.DeepEqual(longest, pd(13, 0, 18, 0)) {
+		t.Errorf("LongestFree() = %v, %v", longest, ok)
+	}
+	if _, ok := LongestFree([]Period{bound}, bound); ok {
+		t.Errorf("fully occupied bound should have no free period")
+	}
+
+	if d := TotalDuration(occupied); d != 8*time.Hour {
+		t.Errorf("TotalDuration() = %v", d)
+	}
+}
+
+func TestContains(t *testing.T) {
+	p := pd(8, 0, 10, 0)
+	if !p.Contains(pd(8, 0, 9, 0)) || p.Contains(pd(9, 0, 11, 0)) {
+		t.Errorf("Contains() gives wrong result")
+	}
+	if !p.ContainsTime(hm(8, 0)) || p.ContainsTime(hm(10, 0)) {
+		t.Errorf("ContainsTime() should be half-open")
+	}
+	if p.Duration() != 2*time.Hour || pd(10, 0, 8, 0).Duration() != 0 {
+		t.Errorf("Duration() gives wrong result")
+	}
+}
@@ -0,0 +1,258 @@
+package library_reservation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCheckInGrace 预约开始后多长时间内必须签到
+const DefaultCheckInGrace = 30 * time.Minute
+
+// CheckIner 自动签到的实现，由调用方提供
+type CheckIner interface {
+	CheckIn(ctx context.Context, stuID string, res Reservation) error
+}
+
+type Reminder interface {
+	// Run 定时读取学生的预约列表，在签到截止前按配置的提前量发送提醒或自动签到，
+	// ctx 结束后返回
+	Run(ctx context.Context, stuIDs ...string) error
+	// CheckInDeadline 根据预约开始时间和区域的签到规则计算签到截止时间
+	CheckInDeadline(res Reservation) time.Time
+}
+
+type ReminderOption func(*reminder)
+
+// WithReminderOffsets 设置在签到截止前多久提醒，默认截止前 20 分钟和 5 分钟各提醒一次
+func WithReminderOffsets(offsets ...time.Duration) ReminderOption {
+	return func(rm *reminder) {
+		if len(offsets) > 0 {
+			rm.offsets = offsets
+		}
+	}
+}
+
+// WithCheckInGrace 设置签到宽限时间，roomName 为空时修改默认值
+func WithCheckInGrace(roomName string, grace time.Duration) ReminderOption {
+	return func(rm *reminder) {
+		if roomName == "" {
+			rm.defaultGrace = grace
+			return
+		}
+		rm.roomGrace[roomName] = grace
+	}
+}
+
+// WithAutoCheckIn 到达提醒时间且预约已经开始时自动签到，失败时再发送提醒
+func WithAutoCheckIn(c CheckIner) ReminderOption {
+	return func(rm *reminder) {
+		rm.checkIner = c
+	}
+}
+
+// WithRefreshInterval 设置重新拉取预约列表的间隔，默认 10 分钟
+func WithRefreshInterval(d time.Duration) ReminderOption {
+	return func(rm *reminder) {
+		if d > 0 {
+			rm.refresh = d
+		}
+	}
+}
+
+// WithReminderErrorHandler 设置查询预约记录、发送提醒失败时的回调，默认用 log 输出到标准错误
+func WithReminderErrorHandler(fn func(stuID string, err error)) ReminderOption {
+	return func(rm *reminder) {
+		if fn != nil {
+			rm.onError = fn
+		}
+	}
+}
+
+type reminder struct {
+	r        Reverser // 需要实现 ReservationLister
+	notifier Notifier
+
+	offsets      []time.Duration
+	defaultGrace time.Duration
+	roomGrace    map[string]time.Duration // roomName -> 签到宽限时间
+	checkIner    CheckIner
+	refresh      time.Duration
+	tick         time.Duration
+	onError      func(stuID string, err error)
+
+	mu           sync.Mutex
+	reservations map[string][]Reservation // stuID -> 预约列表
+	fired        map[string]int           // 已触发的提醒数量
+	checkedIn    map[string]bool
+}
+
+func NewReminder(r Reverser, notifier Notifier, opts ...ReminderOption) Reminder {
+	rm := &reminder{
+		r:            r,
+		notifier:     notifier,
+		offsets:      []time.Duration{20 * time.Minute, 5 * time.Minute},
+		defaultGrace: DefaultCheckInGrace,
+		roomGrace:    make(map[string]time.Duration),
+		refresh:      10 * time.Minute,
+		tick:         15 * time.Second,
+		onError: func(stuID string, err error) {
+			log.Printf("reminder for %s: %v", stuID, err)
+		},
+		reservations: make(map[string][]Reservation),
+		fired:        make(map[string]int),
+		checkedIn:    make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(rm)
+	}
+	// 提前量从大到小排列，依次触发
+	sort.Slice(rm.offsets, func(i, j int) bool { return rm.offsets[i] > rm.offsets[j] })
+	return rm
+}
+
+func (rm *reminder) CheckInDeadline(res Reservation) time.Time {
+	grace, ok := rm.roomGrace[res.RoomName]
+	if !ok {
+		grace = rm.defaultGrace
+	}
+	return res.StartTime.Add(grace)
+}
+
+func (rm *reminder) Run(ctx context.Context, stuIDs ...string) error {
+	if _, ok := rm.r.(ReservationLister); !ok {
+		return fmt.Errorf("reverser does not implement ReservationLister")
+	}
+	rm.refreshAll(ctx, stuIDs)
+
+	refresh := time.NewTicker(rm.refresh)
+	defer refresh.Stop()
+	tick := time.NewTicker(rm.tick)
+	defer tick.Stop()
+
+	for {
+		rm.fire(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-refresh.C:
+			rm.refreshAll(ctx, stuIDs)
+		case <-tick.C:
+		}
+	}
+}
+
+func (rm *reminder) refreshAll(ctx context.Context, stuIDs []string) {
+	for _, stuID := range stuIDs {
+		reservations, err := rm.r.(ReservationLister).GetReservations(ctx, stuID)
+		if err != nil {
+			rm.onError(stuID, fmt.Errorf("failed to get reservations: %w", err))
+			continue
+		}
+		rm.mu.Lock()
+		rm.reservations[stuID] = reservations
+		rm.mu.Unlock()
+	}
+	rm.prune()
+}
+
+// prune 删除已不在预约列表中的预约的提醒状态，避免长期运行时无限增长
+func (rm *reminder) prune() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	keys := make(map[string]bool)
+	for stuID, reservations := range rm.reservations {
+		for _, res := range reservations {
+			keys[reservationKey(stuID, res)] = true
+		}
+	}
+	for key := range rm.fired {
+		if !keys[key] {
+			delete(rm.fired, key)
+		}
+	}
+	for key := range rm.checkedIn {
+		if !keys[key] {
+			delete(rm.checkedIn, key)
+		}
+	}
+}
+
+// reminderDue 描述一次到期的提醒
+type reminderDue struct {
+	stuID    string
+	res      Reservation
+	deadline time.Time
+}
+
+// due 返回当前时刻需要触发的提醒，同一条预约在一次调用中最多触发一次
+func (rm *reminder) due(now time.Time) []reminderDue {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	var dues []reminderDue
+	for stuID, reservations := range rm.reservations {
+		for _, res := range reservations {
+			key := reservationKey(stuID, res)
+			deadline := rm.CheckInDeadline(res)
+			if rm.checkedIn[key] || strings.Contains(res.State, "已签到") || !now.Before(deadline) {
+				continue
+			}
+
+			fired := rm.fired[key]
+			next := fired
+			for next < len(rm.offsets) && !now.Before(deadline.Add(-rm.offsets[next])) {
+				next++
+			}
+			if next == fired {
+				continue
+			}
+			// 错过的提醒合并为一次
+			rm.fired[key] = next
+			dues = append(dues, reminderDue{stuID: stuID, res: res, deadline: deadline})
+		}
+	}
+	return dues
+}
+
+func (rm *reminder) fire(ctx context.Context, now time.Time) {
+	for _, d := range rm.due(now) {
+		n := Notification{
+			Kind:      NotifyCheckInDeadline,
+			StuID:     d.stuID,
+			SeatID:    d.res.SeatName,
+			StartTime: d.res.StartTime,
+			EndTime:   d.res.EndTime,
+			Deadline:  d.deadline,
+			At:        now,
+		}
+
+		if rm.checkIner != nil && !now.Before(d.res.StartTime) {
+			err := rm.checkIner.CheckIn(ctx, d.stuID, d.res)
+			if err == nil {
+				rm.mu.Lock()
+				rm.checkedIn[reservationKey(d.stuID, d.res)] = true
+				rm.mu.Unlock()
+				continue
+			}
+			n.Err = fmt.Sprintf("auto check-in failed: %v", err)
+		}
+
+		if err := rm.notifier.Notify(ctx, n); err != nil {
+			rm.onError(d.stuID, fmt.Errorf("failed to send check-in reminder: %w", err))
+		}
+	}
+}
+
+func reservationKey(stuID string, res Reservation) string {
+	if res.ID != "" {
+		return stuID + "/" + res.ID
+	}
+	return fmt.Sprintf("%s/%s/%d", stuID, res.SeatName, res.StartTime.Unix())
+}
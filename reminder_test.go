@@ -0,0 +1,121 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+type recordNotifier struct {
+	got []Notification
+}
+
+func (r *recordNotifier) Notify(ctx context.Context, n Notification) error {
+	r.got = append(r.got, n)
+	return nil
+}
+
+type failCheckIner struct{}
+
+func (failCheckIner) CheckIn(ctx context.Context, stuID string, res Reservation) error {
+	return errors.New("not in library")
+}
+
+func TestReminderFire(t *testing.T) {
+	start := pkg.CreateShanghaiTime(2025, 6, 1, 14, 0)
+	res := Reservation{ID: "1", SeatName: "N2-001", RoomName: "room", StartTime: start, EndTime: start.Add(4 * time.Hour)}
+
+	n := &recordNotifier{}
+	rm := NewReminder(&fakeReverser{}, n,
+		WithCheckInGrace("room", 15*time.Minute),
+		WithReminderOffsets(10*time.Minute, 2*time.Minute),
+		WithAutoCheckIn(failCheckIner{}),
+	).(*reminder)
+	rm.reservations["stu"] = []Reservation{res}
+
+	deadline := rm.CheckInDeadline(res)
+	if !deadline.Equal(start.Add(15 * time.Minute)) {
+		t.Fatalf("unexpected deadline %v", deadline)
+	}
+
+	ctx := context.Background()
+	rm.fire(ctx, start.Add(-time.Hour))
+	if len(n.got) != 0 {
+		t.Fatalf("no reminder expected an hour before, got %d", len(n.got))
+	}
+	rm.fire(ctx, start.Add(6*time.Minute))
+	rm.fire(ctx, start.Add(7*time.Minute))
+	if len(n.got) != 1 {
+		t.Fatalf("expected exactly one reminder, got %d", len(n.got))
+	}
+	if n.got[0].Err == "" {
+		t.Errorf("failed auto check-in should be reported")
+	}
+	rm.fire(ctx, start.Add(14*time.Minute))
+	rm.fire(ctx, start.Add(20*time.Minute))
+	if len(n.got) != 2 {
+		t.Fatalf("expected two reminders in total, got %d", len(n.got))
+	}
+}
+
+func TestParseReservations(t *testing.T) {
+	html := `<tbody rsvid="123"><tr><td><div class="box"><a>N2-018</a><span class="grey">南湖分馆二楼开敞座位区</span></div></td>
+<td>2025-06-01 14:00-18:00</td><td><span class="text-primary">预约成功</span></td></tr></tbody>`
+
+	reservations, err := parseReservations(html)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(reservations) != 1 {
+		t.Fatalf("expected 1 reservation, got %d", len(reservations))
+	}
+	res := reservations[0]
+	if res.ID != "123" || res.SeatName != "N2-018" || res.State != "预约成功" {
+		t.Errorf("unexpected reservation %+v", res)
+	}
+	if !res.StartTime.Equal(pkg.CreateShanghaiTime(2025, 6, 1, 14, 0)) || !res.EndTime.Equal(pkg.CreateShanghaiTime(2025, 6, 1, 18, 0)) {
+		t.Errorf("unexpected time range %v - %v", res.StartTime, res.EndTime)
+	}
+}
+
+func TestReminderErrorHandler(t *testing.T) {
+	start := pkg.CreateShanghaiTime(2025, 6, 1, 14, 0)
+	res := Reservation{ID: "1", SeatName: "N2-001", RoomName: "room", StartTime: start, EndTime: start.Add(4 * time.Hour)}
+
+	var got []string
+	rm := NewReminder(&fakeReverser{}, failNotifier{},
+		WithReminderOffsets(10*time.Minute),
+		WithReminderErrorHandler(func(stuID string, err error) { got = append(got, stuID) }),
+	).(*reminder)
+	rm.reservations["stu"] = []Reservation{res}
+
+	rm.fire(context.Background(), start.Add(25*time.Minute))
+	if len(got) != 1 || got[0] != "stu" {
+		t.Errorf("expected the failed reminder to be reported for stu, got %v", got)
+	}
+}
+
+func TestReminderPrune(t *testing.T) {
+	start := pkg.CreateShanghaiTime(2025, 6, 1, 14, 0)
+	done := Reservation{ID: "1", SeatName: "N2-001", StartTime: start, EndTime: start.Add(time.Hour)}
+	kept := Reservation{ID: "2", SeatName: "N2-002", StartTime: start, EndTime: start.Add(time.Hour)}
+
+	rm := NewReminder(&fakeReverser{}, &recordNotifier{}).(*reminder)
+	rm.reservations["stu"] = []Reservation{done}
+	rm.reservations["other"] = []Reservation{kept}
+	rm.fired[reservationKey("stu", done)] = 1
+	rm.checkedIn[reservationKey("stu", done)] = true
+	rm.fired[reservationKey("other", kept)] = 1
+
+	// 刷新后 stu 的预约已不再返回，other 未刷新，仍保留
+	rm.refreshAll(context.Background(), []string{"stu"})
+	if len(rm.fired) != 1 || len(rm.checkedIn) != 0 {
+		t.Errorf("stale reminder state not pruned: fired %v, checkedIn %v", rm.fired, rm.checkedIn)
+	}
+	if rm.fired[reservationKey("other", kept)] != 1 {
+		t.Errorf("state of current reservations should be kept")
+	}
+}
@@ -0,0 +1,177 @@
+package library_reservation
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// SeatState 座位在某个时间段内的状态
+type SeatState int
+
+const (
+	SeatStateOccupied SeatState = iota // 整段被占用
+	SeatStatePartial                   // 部分时间空闲
+	SeatStateFree                      // 整段空闲
+)
+
+// seatStateIn 返回座位在 [startTime, endTime] 内的状态，以及空闲时长占比
+func seatStateIn(seat Seat, startTime, endTime time.Time) (SeatState, float64) {
+	free, periods := seat.IsFree(startTime, endTime)
+	if free {
+		return SeatStateFree, 1
+	}
+	if len(periods) == 0 {
+		return SeatStateOccupied, 0
+	}
+	return SeatStatePartial, float64(TotalDuration(periods)) / float64(endTime.Sub(startTime))
+}
+
+type renderCell struct {
+	seat     Seat
+	state    SeatState
+	freeRate float64
+}
+
+// gridOf 按布局把座位放到二维网格中，不在布局中或超出平面图范围的座位会被忽略
+func gridOf(seats []Seat, layout *Layout, startTime, endTime time.Time) ([][]*renderCell, int) {
+	if layout == nil {
+		layout = NewLayoutFromNames(seats, LayoutRule{})
+	}
+
+	rows, cols := 0, 0
+	for _, seat := range seats {
+		if pos, ok := layout.Positions[seat.SeatID]; ok && pos.valid() {
+			rows = max(rows, pos.Row+1)
+			cols = max(cols, pos.Col+1)
+		}
+	}
+
+	grid := make([][]*renderCell, rows)
+	for i := range grid {
+		grid[i] = make([]*renderCell, cols)
+	}
+	for _, seat := range seats {
+		pos, ok := layout.Positions[seat.SeatID]
+		if !ok || !pos.valid() {
+			continue
+		}
+		state, rate := seatStateIn(seat, startTime, endTime)
+		grid[pos.Row][pos.Col] = &renderCell{seat: seat, state: state, freeRate: rate}
+	}
+	return grid, cols
+}
+
+const svgCellSize = 40
+
+// RenderSVG 以 SVG 绘制区域平面图，绿色为整段空闲，黄色为部分空闲（底部绿条表示空闲占比），红色为已占用
+func RenderSVG(w io.Writer, seats []Seat, layout *Layout, startTime, endTime time.Time) error {
+	grid, cols := gridOf(seats, layout, startTime, endTime)
+
+	bw := bufio.NewWriter(w)
+	width := cols*svgCellSize + svgCellSize
+	height := len(grid)*svgCellSize + 2*svgCellSize
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="10">`+"\n", width, height)
+	fmt.Fprintf(bw, `<text x="%d" y="%d" font-size="12">%s - %s</text>`+"\n",
+		svgCellSize/2, svgCellSize/2, startTime.Format("2006-01-02 15:04"), endTime.Format("15:04"))
+
+	for r, row := range grid {
+		for c, cell := range row {
+			if cell == nil {
+				continue
+			}
+			x := svgCellSize/2 + c*svgCellSize
+			y := svgCellSize + r*svgCellSize
+			size := svgCellSize - 4
+
+			fmt.Fprintf(bw, `<g><title>%s</title>`, html.EscapeString(seatTooltip(cell.seat, startTime, endTime)))
+			fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" rx="4" fill="%s" stroke="#555"/>`,
+				x, y, size, size, svgColor(cell.state))
+			if cell.state == SeatStatePartial {
+				bar := int(float64(size) * cell.freeRate)
+				fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="4" fill="%s"/>`,
+					x, y+size-4, bar, svgColor(SeatStateFree))
+			}
+			fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle">%s</text></g>`+"\n",
+				x+size/2, y+size/2+4, html.EscapeString(shortSeatName(cell.seat.SeatName)))
+		}
+	}
+
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+func svgColor(state SeatState) string {
+	switch state {
+	case SeatStateFree:
+		return "#4caf50"
+	case SeatStatePartial:
+		return "#ffc107"
+	default:
+		return "#f44336"
+	}
+}
+
+// RenderASCII 以字符网格绘制区域平面图，color 为 true 时使用终端颜色
+func RenderASCII(w io.Writer, seats []Seat, layout *Layout, startTime, endTime time.Time, color bool) error {
+	grid, _ := gridOf(seats, layout, startTime, endTime)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s - %s\n", startTime.Format("2006-01-02 15:04"), endTime.Format("15:04"))
+	for _, row := range grid {
+		for _, cell := range row {
+			if cell == nil {
+				bw.WriteString("     ")
+				continue
+			}
+			bw.WriteString(asciiCell(cell, color))
+			bw.WriteString(" ")
+		}
+		bw.WriteString("\n")
+	}
+	fmt.Fprintf(bw, "%s 空闲  %s 部分空闲  %s 已占用\n",
+		asciiCell(&renderCell{state: SeatStateFree}, color),
+		asciiCell(&renderCell{state: SeatStatePartial}, color),
+		asciiCell(&renderCell{state: SeatStateOccupied}, color))
+	return bw.Flush()
+}
+
+func asciiCell(cell *renderCell, color bool) string {
+	label := fmt.Sprintf("%3s", shortSeatName(cell.seat.SeatName))
+	if len(label) > 3 {
+		label = label[len(label)-3:]
+	}
+
+	if !color {
+		mark := map[SeatState]string{SeatStateFree: " ", SeatStatePartial: "~", SeatStateOccupied: "X"}[cell.state]
+		return mark + label
+	}
+	code := map[SeatState]string{SeatStateFree: "42", SeatStatePartial: "43", SeatStateOccupied: "41"}[cell.state]
+	return "\x1b[30;" + code + "m " + label + "\x1b[0m"
+}
+
+// shortSeatName 只保留座位编号，例如 "N1M-001" -> "001"
+func shortSeatName(name string) string {
+	if i := strings.LastIndexAny(name, "-_"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+func seatTooltip(seat Seat, startTime, endTime time.Time) string {
+	free, periods := seat.IsFree(startTime, endTime)
+	if free {
+		return seat.SeatName + " 空闲"
+	}
+	if len(periods) == 0 {
+		return seat.SeatName + " 已占用"
+	}
+	parts := make([]string, 0, len(periods))
+	for _, p := range periods {
+		parts = append(parts, p.StartTime.Format("15:04")+"-"+p.EndTime.Format("15:04"))
+	}
+	return seat.SeatName + " 空闲: " + strings.Join(parts, ", ")
+}
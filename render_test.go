@@ -0,0 +1,73 @@
+package library_reservation
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	start := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	end := start.Add(4 * time.Hour)
+	seats := []Seat{
+		NewSeat("1", "N1-001", "r", "room", start, end, true, nil),
+		NewSeat("2", "N1-002", "r", "room", start, end, false, []Period{{StartTime: start, EndTime: start.Add(time.Hour)}}),
+		NewSeat("3", "N1-003", "r", "room", start, end, false, []Period{{StartTime: start, EndTime: end}}),
+	}
+
+	var ascii bytes.Buffer
+	if err := RenderASCII(&ascii, seats, nil, start, end, false); err != nil {
+		t.Fatalf("render ascii failed: %v", err)
+	}
+	lines := strings.Split(ascii.String(), "\n")
+	if len(lines) < 2 || lines[1] != " 001 ~002 " {
+		t.Errorf("unexpected first row %q", lines[1])
+	}
+	if !strings.Contains(ascii.String(), "X003") {
+		t.Errorf("occupied seat not rendered: %q", ascii.String())
+	}
+
+	var svg bytes.Buffer
+	if err := RenderSVG(&svg, seats, nil, start, end); err != nil {
+		t.Fatalf("render svg failed: %v", err)
+	}
+	out := svg.String()
+	if !strings.HasPrefix(out, "<svg") || strings.Count(out, "<title>") != 3 {
+		t.Errorf("unexpected svg output: %s", out)
+	}
+	if !strings.Contains(out, "N1-002 空闲: 09:00-12:00") {
+		t.Errorf("partial free period missing in svg: %s", out)
+	}
+}
+
+func TestRenderInvalidPosition(t *testing.T) {
+	if _, err := LoadLayout(strings.NewReader(`{"positions":{"1":{"row":-1,"col":0}}}`)); err == nil {
+		t.Errorf("expected error for negative position")
+	}
+	if _, err := LoadLayout(strings.NewReader(`{"positions":{"1":{"row":0,"col":1000000000}}}`)); err == nil {
+		t.Errorf("expected error for out-of-range position")
+	}
+
+	start := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	end := start.Add(4 * time.Hour)
+	seats := []Seat{
+		NewSeat("1", "N1-001", "r", "room", start, end, true, nil),
+		NewSeat("2", "N1-002", "r", "room", start, end, true, nil),
+		NewSeat("3", "N1-003", "r", "room", start, end, true, nil),
+	}
+	// 直接构造的布局不经过 LoadLayout 的检查，超出范围的座位跳过
+	layout := &Layout{Positions: map[string]SeatPosition{
+		"1": {Row: 0, Col: 0},
+		"2": {Row: -1, Col: 0},
+		"3": {Row: 0, Col: 1 << 40},
+	}}
+	grid, cols := gridOf(seats, layout, start, end)
+	if len(grid) != 1 || cols != 1 || grid[0][0].seat.SeatID != "1" {
+		t.Errorf("unexpected grid %v, cols %d", grid, cols)
+	}
+	var ascii bytes.Buffer
+	if err := RenderASCII(&ascii, seats, layout, start, end, false); err != nil {
+		t.Fatalf("render ascii failed: %v", err)
+	}
+}
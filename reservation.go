@@ -0,0 +1,144 @@
+package library_reservation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+// Reservation 个人中心里的一条预约记录
+type Reservation struct {
+	ID        string    // 预约编号
+	SeatName  string    // 座位名称
+	RoomName  string    // 区域名称
+	StartTime time.Time // 预约开始时间
+	EndTime   time.Time // 预约结束时间
+	State     string    // 预约状态，例如 "预约成功"、"已签到"
+}
+
+type getReservationsResp struct {
+	Ret  int    `json:"ret"`
+	Act  string `json:"act"`
+	Msg  string `json:"msg"`
+	Data any    `json:"data"`
+	Ext  any    `json:"ext"`
+}
+
+// ReservationLister 可以查询预约记录的 Reverser，NewReverser 返回的 Reverser 实现了该接口
+type ReservationLister interface {
+	GetReservations(ctx context.Context, stuID string) ([]Reservation, error)
+}
+
+// GetReservations 获取学生当前未结束的预约
+func (r *reverser) GetReservations(ctx context.Context, stuID string) ([]Reservation, error) {
+	var reservations []Reservation
+	err := r.opts.retry.retry(ctx, func(int) error {
+		var err error
+		reservations, err = r.getReservations(ctx, stuID)
+		return err
+	})
+	return reservations, err
+}
+
+func (r *reverser) getReservations(ctx context.Context, stuID string) (_ []Reservation, err error) {
+	ctx, span := r.opts.startSpan(ctx, SpanGetReservations, stuID)
+	defer func() { endSpan(span, err) }()
+	sess, err := r.session(ctx, stuID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.opts.timeouts.GetReservations)
+	defer cancel()
+
+	URL := fmt.Sprintf("%s/ClientWeb/pro/ajax/center.aspx?act=get_History_resv&strat=90&StatFlag=New&_=%d", r.opts.kjyyURL, time.Now().UnixMilli())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json, text/javascript, */*; q=0.01")
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9")
+	req.Header.Set("Connection", "keep-alive")
+	req.Header.Set("Referer", r.opts.kjyyURL+"/clientweb/m/a/resvlist.aspx")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/137.0.0.0 Safari/537.36")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	resp, err := r.do(stuID, sess, EndpointReservations, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	bodyText, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var getResp getReservationsResp
+	err = json.Unmarshal(bodyText, &getResp)
+	if err != nil {
+		if isSessionExpired(bodyText, "") {
+			return nil, r.expireSession(ctx, stuID)
+		}
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	span.SetAttributes(Attr("library.ret", getResp.Ret))
+	if getResp.Ret != 1 {
+		if isSessionExpired(nil, getResp.Msg) {
+			return nil, r.expireSession(ctx, stuID)
+		}
+		return nil, fmt.Errorf("failed to get reservations: %w: %s", ErrRequestRejected, getResp.Msg)
+	}
+
+	return parseReservations(getResp.Msg)
+}
+
+// 例如 "2025-06-01 08:00-22:00" 或 "2025-06-01 08:00 至 2025-06-01 22:00"
+var reservationTimeRe = regexp.MustCompile(`(\d{4}-\d{2}-\d{2}) (\d{2}:\d{2})\s*(?:-|~|至)\s*(?:(\d{4}-\d{2}-\d{2}) )?(\d{2}:\d{2})`)
+
+// parseReservations 解析个人中心返回的预约列表 HTML，每个 tbody 对应一条预约
+func parseReservations(html string) ([]Reservation, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<table>" + html + "</table>"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reservations: %w", err)
+	}
+
+	var reservations []Reservation
+	doc.Find("tbody").Each(func(_ int, s *goquery.Selection) {
+		m := reservationTimeRe.FindStringSubmatch(s.Text())
+		if m == nil {
+			return
+		}
+		endDate := m[3]
+		if endDate == "" {
+			endDate = m[1]
+		}
+		startTime, err1 := pkg.TransferStringToTime(m[1]+" "+m[2], pkg.FORMAT2)
+		endTime, err2 := pkg.TransferStringToTime(endDate+" "+m[4], pkg.FORMAT2)
+		if err1 != nil || err2 != nil {
+			return
+		}
+
+		res := Reservation{
+			StartTime: startTime,
+			EndTime:   endTime,
+			SeatName:  strings.TrimSpace(s.Find(".box a").First().Text()),
+			RoomName:  strings.TrimSpace(s.Find(".box .grey").First().Text()),
+			State:     strings.TrimSpace(s.Find(".text-primary, .orange, .green").First().Text()),
+		}
+		if id, ok := s.Attr("rsvid"); ok {
+			res.ID = id
+		} else if id, ok := s.Find("[rsvid]").First().Attr("rsvid"); ok {
+			res.ID = id
+		}
+		reservations = append(reservations, res)
+	})
+	return reservations, nil
+}
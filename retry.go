@@ -0,0 +1,73 @@
+package library_reservation
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy 请求失败后的重试策略
+type RetryPolicy struct {
+	// MaxAttempts 最多尝试的次数（包括第一次），小于等于 1 时不重试
+	MaxAttempts int
+	// BaseDelay 第一次重试前的等待时间，之后每次翻倍
+	BaseDelay time.Duration
+	// MaxDelay 等待时间的上限
+	MaxDelay time.Duration
+	// Jitter 等待时间的随机抖动比例（0~1）
+	Jitter float64
+	// Retryable 判断错误是否可以重试，nil 时使用 IsRetryable
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy 默认最多尝试 3 次，等待 500ms、1s
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// NoRetry 不重试
+func NoRetry() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// delay 返回第 attempt 次尝试失败后的等待时间，attempt 从 1 开始
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+	}
+	return d
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// retry 执行 fn 直到成功、遇到不可重试的错误、ctx 结束或达到最大次数，fn 的参数是当前的尝试次数。
+// 单次尝试超时但 ctx 还没有结束时会继续重试
+func (p RetryPolicy) retry(ctx context.Context, fn func(attempt int) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(attempt)
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !p.retryable(err) {
+			return err
+		}
+		if !sleepCtx(ctx, p.delay(attempt)) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+// staticAuther 所有学生都使用 ASP.NET_SessionId=test 的会话
+type staticAuther struct {
+	jar  http.CookieJar
+	base *url.URL
+}
+
+func newStaticAuther(kjyyURL string) *staticAuther {
+	base, _ := url.Parse(kjyyURL)
+	jar, _ := cookiejar.New(nil)
+	jar.SetCookies(base, []*http.Cookie{{Name: CookieKey1, Value: "test"}})
+	return &staticAuther{jar: jar, base: base}
+}
+
+func (a *staticAuther) StoreStuInfo(context.Context, string, string) error { return nil }
+func (a *staticAuther) Invalidate(context.Context, string) error           { return nil }
+func (a *staticAuther) GetSession(_ context.Context, stuID string) (*Session, error) {
+	return &Session{StuID: stuID, Jar: a.jar, base: a.base, cookie: CookieKey1 + "=test"}, nil
+}
+func (a *staticAuther) GetCookie(context.Context, string) (string, error) {
+	return CookieKey1 + "=test", nil
+}
+
+func newTestReverser(t *testing.T, handler http.Handler, opts ...Option) *reverser {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	opts = append([]Option{
+		WithLimiter(NewLimiter(LimiterConfig{})),
+		WithBreaker(NewBreaker(BreakerConfig{})),
+		WithBaseURLs(srv.URL, srv.URL+"/cas"),
+	}, opts...)
+	return NewReverser(newStaticAuther(srv.URL), opts...).(*reverser)
+}
+
+// dropConnection 不返回任何响应直接断开连接
+func dropConnection(w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&NetworkError{Endpoint: EndpointSeats, Err: errors.New("connection reset")}, true},
+		{fmt.Errorf("failed to send request: %w", &HTTPError{Endpoint: EndpointSeats, StatusCode: 502}), true},
+		{&HTTPError{Endpoint: EndpointSeats, StatusCode: 429}, true},
+		{&HTTPError{Endpoint: EndpointSeats, StatusCode: 404}, false},
+		{fmt.Errorf("%w: 该时间段已被预约", ErrReverseRejected), false},
+		{&NetworkError{Endpoint: EndpointSeats, Err: context.DeadlineExceeded}, true},
+		{&NetworkError{Endpoint: EndpointSeats, Err: context.Canceled}, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := IsRetryable(c.err); got != c.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestGetSeatsRetry(t *testing.T) {
+	var calls int32
+	r := newTestReverser(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"ret":1,"data":[]}`)
+	}), WithRetryPolicy(fastRetry))
+
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 8, 0)
+	if _, err := r.GetSeatsByTime(context.Background(), "a", "101", start, start.Add(time.Hour), false); err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestReverseNotDuplicated(t *testing.T) {
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 14, 0)
+	end := pkg.CreateShanghaiTime(2025, 6, 2, 18, 0)
+
+	var reserveCalls int32
+	r := newTestReverser(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.Contains(req.URL.Path, "reserve.aspx"):
+			// 预约已经成功，但响应丢失
+			atomic.AddInt32(&reserveCalls, 1)
+			dropConnection(w)
+		case strings.Contains(req.URL.Path, "center.aspx"):
+			html := `<tbody rsvid="1"><tr><td><div class="box"><a>N1-001</a></div></td><td>2025-06-02 14:00-18:00</td></tr></tbody>`
+			fmt.Fprintf(w, `{"ret":1,"msg":%q}`, html)
+		}
+	}), WithRetryPolicy(fastRetry))
+
+	if err := r.Reverse(context.Background(), "a", "101", start, end); err != nil {
+		t.Fatalf("expected reverse to be detected as done, got %v", err)
+	}
+	if reserveCalls != 1 {
+		t.Errorf("expected reserve to be sent once, got %d", reserveCalls)
+	}
+}
+
+func TestReverseNotResentWhenCheckFails(t *testing.T) {
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 14, 0)
+
+	var reserveCalls int32
+	r := newTestReverser(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.Contains(req.URL.Path, "reserve.aspx"):
+			atomic.AddInt32(&reserveCalls, 1)
+			dropConnection(w)
+		case strings.Contains(req.URL.Path, "center.aspx"):
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}), WithRetryPolicy(fastRetry))
+
+	err := r.Reverse(context.Background(), "a", "101", start, start.Add(time.Hour))
+	if err == nil {
+		t.Fatal("expected an error when the previous attempt cannot be confirmed")
+	}
+	if reserveCalls != 1 {
+		t.Errorf("reserve must not be resent without confirmation, got %d calls", reserveCalls)
+	}
+}
+
+func TestReverseCheckMatchesSeat(t *testing.T) {
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 14, 0)
+	end := pkg.CreateShanghaiTime(2025, 6, 2, 18, 0)
+
+	var reserveCalls int32
+	r := newTestReverser(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.Contains(req.URL.Path, "device.aspx"):
+			fmt.Fprint(w, `{"ret":1,"data":[{"devId":"101","devName":"N1-002"}]}`)
+		case strings.Contains(req.URL.Path, "reserve.aspx"):
+			if atomic.AddInt32(&reserveCalls, 1) == 1 {
+				dropConnection(w)
+				return
+			}
+			fmt.Fprint(w, `{"ret":1}`)
+		case strings.Contains(req.URL.Path, "center.aspx"):
+			// 时间有重叠（个人中心显示的时间被取整），但是另一个座位
+			html := `<tbody rsvid="1"><tr><td><div class="box"><a>N1-001</a></div></td><td>2025-06-02 14:00-18:00</td></tr></tbody>`
+			fmt.Fprintf(w, `{"ret":1,"msg":%q}`, html)
+		}
+	}), WithRetryPolicy(fastRetry))
+
+	if _, err := r.GetSeatsByTime(context.Background(), "a", "101", start, end, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reverse(context.Background(), "a", "101", start.Add(5*time.Minute), end); err != nil {
+		t.Fatalf("expected reverse to succeed, got %v", err)
+	}
+	if reserveCalls != 2 {
+		t.Errorf("a reservation for another seat should not count as done, got %d reserve calls", reserveCalls)
+	}
+}
+
+func TestReverseRejectedNotRetried(t *testing.T) {
+	var calls int32
+	r := newTestReverser(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		fmt.Fprint(w, `{"ret":0,"msg":"该时间段已被预约"}`)
+	}), WithRetryPolicy(fastRetry))
+
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 14, 0)
+	err := r.Reverse(context.Background(), "a", "101", start, start.Add(time.Hour))
+	if !errors.Is(err, ErrReverseRejected) {
+		t.Fatalf("expected ErrReverseRejected, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("rejected reverse should not be retried, got %d calls", calls)
+	}
+}
@@ -9,28 +9,42 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"sort"
+	"sync"
 	"time"
 )
 
 type Reverser interface {
-	GetSeatsByTime(ctx context.Context, stuID, roomID string, startTime, endTime time.Time, onlyAvailable bool) ([]Seat, error)
+	// GetSeatsByTime 查询区域在时间段内的座位，filters 用于按楼宇、设备状态等信息筛选
+	GetSeatsByTime(ctx context.Context, stuID, roomID string, startTime, endTime time.Time, onlyAvailable bool, filters ...SeatFilter) ([]Seat, error)
 	Reverse(ctx context.Context, stuID, seatID string, startTime, endTime time.Time) error
 }
 
 type reverser struct {
-	cli *http.Client
-	au  Auther
+	cli       *http.Client // 没有 cookie jar 的会话共用
+	transport http.RoundTripper
+	au        Auther
+	opts      options
+
+	clients  map[string]*http.Client // stuID -> 使用该学生会话的 http.Client
+	clientMu sync.Mutex
+
+	seatNames map[string]string // 座位 ID -> 座位名称
+	seatMu    sync.RWMutex
 }
 
-func NewReverser(au Auther) Reverser {
+func NewReverser(au Auther, opts ...Option) Reverser {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
-	client := &http.Client{Transport: tr}
+	o := newOptions(opts)
+	transport := o.transport(tr)
 	return &reverser{
-		cli: client,
-		au:  au,
+		cli:       &http.Client{Transport: transport},
+		transport: transport,
+		au:        au,
+		opts:      o,
+		clients:   make(map[string]*http.Client),
+		seatNames: make(map[string]string),
 	}
 }
 
@@ -42,29 +56,101 @@ type ReverseResponse struct {
 	Ext  interface{} `json:"ext"`
 }
 
-// Reverse 预约座位
-func (r *reverser) Reverse(ctx context.Context, stuID, seatID string, startTime time.Time, endTime time.Time) error {
+// Reverse 预约座位，遇到暂时性错误时按重试策略重试
+func (r *reverser) Reverse(ctx context.Context, stuID, seatID string, startTime time.Time, endTime time.Time) (err error) {
+	defer func(start time.Time) { r.opts.observe(OpReverse, start, err) }(time.Now())
+	ctx, span := r.opts.startSpan(ctx, SpanReverse, stuID, Attr("seat.id", seatID))
+	defer func() { endSpan(span, err) }()
+
+	err = r.opts.retry.retry(ctx, func(attempt int) error {
+		// 上一次请求可能已经被处理，只是没有收到响应，重新发送前先确认，避免重复预约。
+		// 无法确认时不重新发送，等待下一次尝试再确认
+		if attempt > 1 {
+			done, err := r.reversed(ctx, stuID, seatID, startTime, endTime)
+			if err != nil {
+				return fmt.Errorf("failed to check previous attempt: %w", err)
+			}
+			if done {
+				return nil
+			}
+		}
+		return r.reverse(ctx, stuID, seatID, startTime, endTime)
+	})
+
+	n := Notification{Kind: NotifyReverseSuccess, StuID: stuID, SeatID: seatID, StartTime: startTime, EndTime: endTime}
+	if err != nil {
+		n.Kind = NotifyReverseFailure
+		n.Err = err.Error()
+	}
+	r.opts.notify(ctx, n)
+
+	return err
+}
+
+// reversed 判断学生是否已经有这个座位在这个时间段的预约。个人中心显示的时间可能被取整，所以按时间段重叠判断。
+// 预约记录里只有座位名称没有座位 ID，名称取自之前查询到的座位；不知道名称时，
+// 由于同一个学生不能预约重叠的时间段，只按时间判断
+func (r *reverser) reversed(ctx context.Context, stuID, seatID string, startTime, endTime time.Time) (bool, error) {
+	reservations, err := r.getReservations(ctx, stuID)
+	if err != nil {
+		return false, err
+	}
+	name := r.seatName(seatID)
+	want := Period{StartTime: startTime, EndTime: endTime}
+	for _, res := range reservations {
+		if name != "" && res.SeatName != name {
+			continue
+		}
+		if want.Overlaps(Period{StartTime: res.StartTime, EndTime: res.EndTime}) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// rememberSeats 记录查询到的座位名称，用于在预约记录中找到对应的座位
+func (r *reverser) rememberSeats(seats []crawSeatInfo) {
+	r.seatMu.Lock()
+	defer r.seatMu.Unlock()
+	for _, s := range seats {
+		if s.DevID != "" && s.DevName != "" {
+			r.seatNames[s.DevID] = s.DevName
+		}
+	}
+}
+
+func (r *reverser) seatName(seatID string) string {
+	r.seatMu.RLock()
+	defer r.seatMu.RUnlock()
+	return r.seatNames[seatID]
+}
+
+func (r *reverser) reverse(ctx context.Context, stuID, seatID string, startTime time.Time, endTime time.Time) (err error) {
+	ctx, span := r.opts.startSpan(ctx, SpanReverseAttempt, stuID, Attr("seat.id", seatID))
+	defer func() { endSpan(span, err) }()
 
-	cookie, err := r.au.GetCookie(ctx, stuID)
+	sess, err := r.session(ctx, stuID)
 	if err != nil {
-		return fmt.Errorf("failed to get cookie: %w", err)
+		return fmt.Errorf("failed to get session: %w", err)
 	}
 
-	reverseURL := fmt.Sprintf("http://kjyy.ccnu.edu.cn/ClientWeb/pro/ajax/reserve.aspx?dialogid=&dev_id=%s&lab_id=&kind_id=&room_id=&type=dev&prop=&test_id=&term=&Vnumber=&classkind=&test_name=&start=%s&end=%s&start_time=%d&end_time=%d&up_file=&memo=&act=set_resv&_=%d",
-		seatID, url.QueryEscape(pkg.TransferTimeToString(startTime, pkg.FORMAT2)), url.QueryEscape(pkg.TransferTimeToString(endTime, pkg.FORMAT2)), transferTimeToInt(startTime), transferTimeToInt(endTime), time.Now().UnixMilli())
+	ctx, cancel := context.WithTimeout(ctx, r.opts.timeouts.Reverse)
+	defer cancel()
+
+	reverseURL := fmt.Sprintf("%s/ClientWeb/pro/ajax/reserve.aspx?dialogid=&dev_id=%s&lab_id=&kind_id=&room_id=&type=dev&prop=&test_id=&term=&Vnumber=&classkind=&test_name=&start=%s&end=%s&start_time=%d&end_time=%d&up_file=&memo=&act=set_resv&_=%d",
+		r.opts.kjyyURL, seatID, url.QueryEscape(pkg.TransferTimeToString(startTime, pkg.FORMAT2)), url.QueryEscape(pkg.TransferTimeToString(endTime, pkg.FORMAT2)), transferTimeToInt(startTime), transferTimeToInt(endTime), time.Now().UnixMilli())
 
-	req, err := http.NewRequest("GET", reverseURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", reverseURL, nil)
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Accept", "application/json, text/javascript, */*; q=0.01")
 	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
 	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("Referer", "http://kjyy.ccnu.edu.cn/clientweb/xcus/ic2/Default.aspx")
+	req.Header.Set("Referer", r.opts.kjyyURL+"/clientweb/xcus/ic2/Default.aspx")
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/137.0.0.0 Safari/537.36")
 	req.Header.Set("X-Requested-With", "XMLHttpRequest")
-	req.Header.Set("Cookie", cookie)
-	resp, err := r.cli.Do(req)
+	resp, err := r.do(stuID, sess, EndpointReserve, req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -78,23 +164,53 @@ func (r *reverser) Reverse(ctx context.Context, stuID, seatID string, startTime
 
 	err = json.Unmarshal(bodyText, &reverseResponse)
 	if err != nil {
+		if isSessionExpired(bodyText, "") {
+			return r.expireSession(ctx, stuID)
+		}
 		return fmt.Errorf("failed to unmarshal response: %w", err)
 	}
+	span.SetAttributes(Attr("library.ret", reverseResponse.Ret))
 
 	if reverseResponse.Ret == 1 {
 		return nil
 	}
+	if isSessionExpired(nil, reverseResponse.Msg) {
+		return r.expireSession(ctx, stuID)
+	}
 
-	return fmt.Errorf("failed to reverse: %s", reverseResponse.Msg)
+	return fmt.Errorf("%w: %s", ErrReverseRejected, reverseResponse.Msg)
 }
 
-func (r *reverser) GetSeatsByTime(ctx context.Context, stuID, roomID string, startTime time.Time, endTime time.Time, onlyAvailable bool) ([]Seat, error) {
-	cseats, err := r.getSeats(ctx, stuID, roomID, startTime, endTime)
+func (r *reverser) GetSeatsByTime(ctx context.Context, stuID, roomID string, startTime time.Time, endTime time.Time, onlyAvailable bool, filters ...SeatFilter) ([]Seat, error) {
+	var cseats []crawSeatInfo
+	err := r.opts.retry.retry(ctx, func(int) error {
+		var err error
+		cseats, err = r.getSeats(ctx, stuID, roomID, startTime, endTime)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	seats := transferCrawSeat(cseats, startTime, endTime)
+	seats, warnings := transferCrawSeat(cseats, startTime, endTime)
+	for _, w := range warnings {
+		r.opts.onWarning(w)
+	}
+	if r.opts.deviceStatus != nil {
+		for i := range seats {
+			seats[i].Details.Status = r.opts.deviceStatus(seats[i].Details.DevSta, seats[i].Details.RunSta)
+		}
+	}
+
+	if len(filters) > 0 {
+		filtered := seats[:0]
+		for _, seat := range seats {
+			if matchFilters(seat, filters) {
+				filtered = append(filtered, seat)
+			}
+		}
+		seats = filtered
+	}
 
 	if !onlyAvailable {
 		return seats, err
@@ -107,32 +223,38 @@ func (r *reverser) GetSeatsByTime(ctx context.Context, stuID, roomID string, sta
 		}
 	}
 	if len(availableSeats) == 0 {
-		return nil, fmt.Errorf("no available seats found in the specified time range")
+		return nil, ErrNoAvailableSeat
 	}
 	return availableSeats, nil
 }
 
-func (r *reverser) getSeats(ctx context.Context, stuID, roomID string, startTime time.Time, endTime time.Time) ([]crawSeatInfo, error) {
-	cookie, err := r.au.GetCookie(ctx, stuID)
+func (r *reverser) getSeats(ctx context.Context, stuID, roomID string, startTime time.Time, endTime time.Time) (_ []crawSeatInfo, err error) {
+	defer func(start time.Time) { r.opts.observe(OpGetSeats, start, err) }(time.Now())
+	ctx, span := r.opts.startSpan(ctx, SpanGetSeats, stuID, Attr("room.id", roomID))
+	defer func() { endSpan(span, err) }()
+
+	sess, err := r.session(ctx, stuID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get cookie: %w", err)
+		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
 
-	URL := fmt.Sprintf("http://kjyy.ccnu.edu.cn/ClientWeb/pro/ajax/device.aspx?byType=devcls&classkind=8&display=fp&md=d&room_id=%s&purpose=&selectOpenAty=&cld_name=default&date=%s&fr_start=%s&fr_end=%s&act=get_rsv_sta&_=%d",
-		roomID, url.QueryEscape(pkg.TransferTimeToString(startTime, pkg.FORMAT1)), url.QueryEscape(pkg.TransferTimeToString(startTime, pkg.FORMAT3)), url.QueryEscape(pkg.TransferTimeToString(endTime, pkg.FORMAT3)), time.Now().UnixMilli())
+	ctx, cancel := context.WithTimeout(ctx, r.opts.timeouts.GetSeats)
+	defer cancel()
+
+	URL := fmt.Sprintf("%s/ClientWeb/pro/ajax/device.aspx?byType=devcls&classkind=8&display=fp&md=d&room_id=%s&purpose=&selectOpenAty=&cld_name=default&date=%s&fr_start=%s&fr_end=%s&act=get_rsv_sta&_=%d",
+		r.opts.kjyyURL, roomID, url.QueryEscape(pkg.TransferTimeToString(startTime, pkg.FORMAT1)), url.QueryEscape(pkg.TransferTimeToString(startTime, pkg.FORMAT3)), url.QueryEscape(pkg.TransferTimeToString(endTime, pkg.FORMAT3)), time.Now().UnixMilli())
 
-	req, err := http.NewRequest("GET", URL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Accept", "application/json, text/javascript, */*; q=0.01")
 	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9")
 	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("Referer", "http://kjyy.ccnu.edu.cn/clientweb/xcus/ic2/Default.aspx")
+	req.Header.Set("Referer", r.opts.kjyyURL+"/clientweb/xcus/ic2/Default.aspx")
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/137.0.0.0 Safari/537.36")
 	req.Header.Set("X-Requested-With", "XMLHttpRequest")
-	req.Header.Set("Cookie", cookie)
-	resp, err := r.cli.Do(req)
+	resp, err := r.do(stuID, sess, EndpointSeats, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -145,13 +267,21 @@ func (r *reverser) getSeats(ctx context.Context, stuID, roomID string, startTime
 	var getSeatResp getSeatResp
 	err = json.Unmarshal(bodyText, &getSeatResp)
 	if err != nil {
+		if isSessionExpired(bodyText, "") {
+			return nil, r.expireSession(ctx, stuID)
+		}
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
+	span.SetAttributes(Attr("library.ret", getSeatResp.Ret), Attr("seat.count", len(getSeatResp.Data)))
 	if getSeatResp.Ret != 1 {
-		return nil, fmt.Errorf("failed to get available seats: %s", getSeatResp.Msg)
+		if isSessionExpired(nil, getSeatResp.Msg) {
+			return nil, r.expireSession(ctx, stuID)
+		}
+		return nil, fmt.Errorf("failed to get available seats: %w: %s", ErrRequestRejected, getSeatResp.Msg)
 	}
 
 	fmt.Println("Get available seats successfully,number of seats:", len(getSeatResp.Data))
+	r.rememberSeats(getSeatResp.Data)
 
 	return getSeatResp.Data, nil
 }
@@ -240,42 +370,64 @@ type crawSeatInfo struct {
 	Ops          []ops    `json:"ops"`
 }
 
-func transferCrawSeat(infos []crawSeatInfo, reserveStartTime, reserveEndTime time.Time) []Seat {
+// ParseWarning 座位数据中无法解析的占用记录，对应的记录会被忽略
+type ParseWarning struct {
+	SeatID string
+	Start  string
+	End    string
+	Err    error
+}
+
+func (w *ParseWarning) Error() string {
+	return fmt.Sprintf("seat %s: malformed occupy period %q - %q: %v", w.SeatID, w.Start, w.End, w.Err)
+}
+
+func (w *ParseWarning) Unwrap() error {
+	return w.Err
+}
+
+// transferCrawSeat 把接口返回的座位数据转换为 Seat，
+// 无法解析的占用记录会被忽略并作为 ParseWarning 返回
+func transferCrawSeat(infos []crawSeatInfo, reserveStartTime, reserveEndTime time.Time) ([]Seat, []error) {
 	seats := make([]Seat, 0, len(infos))
+	window := Period{StartTime: reserveStartTime, EndTime: reserveEndTime}
+	var warnings []error
 
 	for _, info := range infos {
 		var occupyStates []Period
 		for _, t := range info.Ts {
-			startTime, _ := pkg.TransferStringToTime(t.Start, pkg.FORMAT2)
-			endTime, _ := pkg.TransferStringToTime(t.End, pkg.FORMAT2)
-
-			if startTime.After(reserveEndTime) {
-				continue
-			}
-			if endTime.Before(reserveStartTime) {
-				continue
+			startTime, err := pkg.TransferStringToTime(t.Start, pkg.FORMAT2)
+			if err == nil {
+				var endTime time.Time
+				endTime, err = pkg.TransferStringToTime(t.End, pkg.FORMAT2)
+				if err == nil && !startTime.Before(endTime) {
+					err = fmt.Errorf("start time is not before end time")
+				}
+				if err == nil {
+					// 只保留预定时间段内的部分，与预定时间段首尾相接的记录不算占用
+					if occupy, ok := Intersect(Period{Owner: t.Owner, StartTime: startTime, EndTime: endTime}, window); ok {
+						occupyStates = append(occupyStates, occupy)
+					}
+					continue
+				}
 			}
-
-			occupyStates = append(occupyStates, Period{
-				Owner:     t.Owner,
-				StartTime: pkg.MaxTime(startTime, reserveStartTime),
-				EndTime:   pkg.MinTime(endTime, reserveEndTime),
-			})
+			warnings = append(warnings, &ParseWarning{SeatID: info.DevID, Start: t.Start, End: t.End, Err: err})
 		}
 
-		// 对占用状态进行排序
-		sort.Slice(occupyStates, func(i, j int) bool {
-			if occupyStates[i].StartTime.Equal(occupyStates[j].StartTime) {
-				return occupyStates[i].EndTime.Before(occupyStates[j].EndTime)
-			}
-			return occupyStates[i].StartTime.Before(occupyStates[j].StartTime)
-		})
+		// 首尾相接的占用记录属于不同的预约，保持分开
+		occupyStates = merge(occupyStates, false)
 
 		roomID := fmt.Sprintf("%d", info.RoomID)
 
+		// 接口认为空闲但时间段内仍有占用记录时，以占用记录为准
+		isFree := info.FreeSta == 0 && len(occupyStates) == 0
+
 		seat := NewSeat(info.DevID, info.DevName, roomID, info.RoomName, reserveStartTime,
-			reserveEndTime, info.FreeSta == 0, occupyStates)
+			reserveEndTime, isFree, occupyStates)
+		details, detailWarnings := detailsFromCraw(info, window)
+		seat.Details = details
+		warnings = append(warnings, detailWarnings...)
 		seats = append(seats, seat)
 	}
-	return seats
+	return seats, warnings
 }
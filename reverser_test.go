@@ -0,0 +1,173 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+// randomSeatData 随机生成的座位数据，用于性质测试
+type randomSeatData struct {
+	Window Period
+	Info   crawSeatInfo
+}
+
+func (randomSeatData) Generate(r *rand.Rand, size int) reflect.Value {
+	base := pkg.CreateShanghaiTime(2025, 6, 1, 7, 0)
+	minute := func(n int) time.Time { return base.Add(time.Duration(n) * time.Minute) }
+
+	// 以 5 分钟为粒度，便于产生首尾相接和重叠的记录
+	ws := r.Intn(100) * 5
+	we := ws + 5 + r.Intn(100)*5
+	data := randomSeatData{
+		Window: Period{StartTime: minute(ws), EndTime: minute(we)},
+		Info:   crawSeatInfo{DevID: "1", DevName: "N1-001", FreeSta: r.Intn(2)},
+	}
+
+	for i := r.Intn(size + 1); i > 0; i-- {
+		s := r.Intn(200) * 5
+		e := s + r.Intn(60)*5
+		t := ts{
+			Start: pkg.TransferTimeToString(minute(s), pkg.FORMAT2),
+			End:   pkg.TransferTimeToString(minute(e), pkg.FORMAT2),
+			Owner: string(rune('a' + r.Intn(3))),
+		}
+		switch r.Intn(10) {
+		case 0:
+			t.Start = "not a time"
+		case 1:
+			t.End = ""
+		}
+		data.Info.Ts = append(data.Info.Ts, t)
+	}
+	return reflect.ValueOf(data)
+}
+
+func TestTransferCrawSeatCoversWindow(t *testing.T) {
+	property := func(data randomSeatData) bool {
+		seats, _ := transferCrawSeat([]crawSeatInfo{data.Info}, data.Window.StartTime, data.Window.EndTime)
+		if len(seats) != 1 {
+			return false
+		}
+		seat := seats[0]
+		_, free := seat.IsFree(data.Window.StartTime, data.Window.EndTime)
+		occupied := seat.OccupyStates
+
+		// 占用记录有序、互不重叠、非空且都在预定时间段内
+		for i, p := range occupied {
+			if p.IsEmpty() || !data.Window.Contains(p) {
+				return false
+			}
+			if i > 0 && p.StartTime.Before(occupied[i-1].EndTime) {
+				return false
+			}
+		}
+		// 空闲与占用互不重叠，且恰好覆盖整个预定时间段
+		if len(IntersectAll(free, occupied)) != 0 {
+			return false
+		}
+		union := Union(free, occupied)
+		return len(union) == 1 && union[0].StartTime.Equal(data.Window.StartTime) && union[0].EndTime.Equal(data.Window.EndTime)
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransferCrawSeatWarnings(t *testing.T) {
+	start := pkg.CreateShanghaiTime(2025, 6, 1, 8, 0)
+	end := pkg.CreateShanghaiTime(2025, 6, 1, 12, 0)
+	info := crawSeatInfo{DevID: "1", FreeSta: 0, Ts: []ts{
+		{Start: "2025-06-01 07:00", End: "2025-06-01 08:00"}, // 与预定时间段首尾相接
+		{Start: "2025-06-01 09:00", End: "2025-06-01 10:00", Owner: "a"},
+		{Start: "2025-06-01 10:00", End: "2025-06-01 10:30", Owner: "b"}, // 与上一条首尾相接
+		{Start: "2025-06-01 09:30", End: "2025-06-01 09:45", Owner: "a"}, // 与第二条重叠
+		{Start: "bad", End: "2025-06-01 10:00"},
+		{Start: "2025-06-01 11:00", End: "2025-06-01 10:00"},
+	}}
+
+	seats, warnings := transferCrawSeat([]crawSeatInfo{info}, start, end)
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %v", warnings)
+	}
+	var pw *ParseWarning
+	if !errors.As(warnings[0], &pw) || pw.Start != "bad" {
+		t.Errorf("unexpected warning %v", warnings[0])
+	}
+
+	seat := seats[0]
+	want := []Period{
+		{Owner: "a", StartTime: pkg.CreateShanghaiTime(2025, 6, 1, 9, 0), EndTime: pkg.CreateShanghaiTime(2025, 6, 1, 10, 0)},
+		{Owner: "b", StartTime: pkg.CreateShanghaiTime(2025, 6, 1, 10, 0), EndTime: pkg.CreateShanghaiTime(2025, 6, 1, 10, 30)},
+	}
+	if !reflect.DeepEqual(seat.OccupyStates, want) {
+		t.Errorf("OccupyStates = %v, want %v", seat.OccupyStates, want)
+	}
+	if free, _ := seat.IsFree(start, end); free {
+		t.Errorf("seat with occupy periods should not be free even if freeSta is 0")
+	}
+}
+
+func TestTransferCrawSeatDetails(t *testing.T) {
+	start := pkg.CreateShanghaiTime(2025, 6, 1, 8, 0)
+	end := pkg.CreateShanghaiTime(2025, 6, 1, 12, 0)
+	infos := []crawSeatInfo{
+		{DevID: "1", BuildingName: "南湖分馆", Campus: "南湖校区", Devsta: 1, AllowLong: true,
+			Ops: []ops{{Start: "2025-06-01 07:30", End: "2025-06-01 22:00"}}},
+		{DevID: "2", BuildingName: "南湖分馆", Devsta: 2},
+	}
+
+	seats, warnings := transferCrawSeat(infos, start, end)
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+	d := seats[0].Details
+	if d.Status != DeviceNormal || !d.AllowLong || d.Campus != "南湖校区" {
+		t.Errorf("unexpected details %+v", d)
+	}
+	if len(d.OpenPeriods) != 1 || !d.OpenPeriods[0].StartTime.Equal(start) || !d.OpenPeriods[0].EndTime.Equal(end) {
+		t.Errorf("open periods should be clipped to the window, got %v", d.OpenPeriods)
+	}
+	// 没有确认过的 devsta 不能当作停用
+	if seats[1].Details.Status != DeviceUnknown || !matchFilters(seats[1], []SeatFilter{InService()}) {
+		t.Errorf("seat 2 should have an unknown status and stay in service, got %v", seats[1].Details.Status)
+	}
+
+	filters := []SeatFilter{InService(), InBuilding("南湖分馆"), OpenDuring(start, end)}
+	if !matchFilters(seats[0], filters) || matchFilters(seats[1], append(filters, AllowLongTerm())) {
+		t.Errorf("filters give wrong result")
+	}
+}
+
+func TestDeviceStatusMapping(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"ret":1,"data":[{"devId":"1","devName":"N1-001","devsta":1},{"devId":"2","devName":"N1-002","devsta":2}]}`)
+	})
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 14, 0)
+	ctx := context.Background()
+
+	// 默认无法识别 devsta 为 2 的座位，不会被过滤
+	r := newTestReverser(t, handler)
+	if seats, err := r.GetSeatsByTime(ctx, "a", "101", start, start.Add(time.Hour), false, InService()); err != nil || len(seats) != 2 {
+		t.Fatalf("expected 2 seats by default, got %v, %v", seats, err)
+	}
+
+	r = newTestReverser(t, handler, WithDeviceStatusMapping(func(devsta, runsta int) DeviceStatus {
+		if devsta == 2 {
+			return DeviceMaintenance
+		}
+		return deviceStatusOf(devsta)
+	}))
+	seats, err := r.GetSeatsByTime(ctx, "a", "101", start, start.Add(time.Hour), false, InService())
+	if err != nil || len(seats) != 1 || seats[0].SeatID != "1" {
+		t.Errorf("seat under maintenance should be filtered out, got %v, %v", seats, err)
+	}
+}
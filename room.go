@@ -7,3 +7,10 @@ var (
 		"n2":  "101699189", //南湖分馆二楼开敞座位区
 	}
 )
+
+var (
+	// Buildings 楼宇名称 -> 区域ID
+	Buildings = map[string][]string{
+		"南湖分馆": {Rooms["n1"], Rooms["n1m"], Rooms["n2"]},
+	}
+)
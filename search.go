@@ -0,0 +1,185 @@
+package library_reservation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SearchQuery 跨区域、跨时间段的座位查询条件
+type SearchQuery struct {
+	// RoomIDs 需要查询的区域
+	RoomIDs []string
+	// Building 楼宇名称，RoomIDs 为空时查询 Buildings 中该楼宇的全部区域
+	Building string
+	// Windows 候选时间段，可以跨越多天
+	Windows []Period
+	// MinDuration 座位在候选时间段内至少连续空闲的时长，0 表示必须整段空闲
+	MinDuration time.Duration
+	// Filters 按楼宇、设备状态等信息筛选座位
+	Filters []SeatFilter
+	// Concurrency 同时进行的查询数量，默认 3
+	Concurrency int
+	// Interval 相邻两次查询之间的最小间隔，默认 500ms
+	Interval time.Duration
+}
+
+// SearchResult 一个满足条件的座位
+type SearchResult struct {
+	Seat   Seat
+	Window Period // 命中的候选时间段
+	Free   Period // 候选时间段内最长的连续空闲时间段
+}
+
+// SearchReport 查询结果，部分区域查询失败时 Results 中仍包含其它区域的结果
+type SearchReport struct {
+	Results  []SearchResult
+	Failures []error
+}
+
+type Searcher interface {
+	// Search 并发查询所有区域和候选时间段，合并后按空闲时长从长到短、开始时间从早到晚排序
+	Search(ctx context.Context, stuID string, q SearchQuery) (*SearchReport, error)
+	// SearchFlexible 在一个较大的时间段内，为每个座位寻找最早和最长的空闲时间段
+	SearchFlexible(ctx context.Context, stuID, roomID string, q FlexibleQuery) ([]FreeBlocks, error)
+}
+
+type searcher struct {
+	r Reverser
+}
+
+func NewSearcher(r Reverser) Searcher {
+	return &searcher{r: r}
+}
+
+func (s *searcher) Search(ctx context.Context, stuID string, q SearchQuery) (*SearchReport, error) {
+	roomIDs := q.RoomIDs
+	if len(roomIDs) == 0 {
+		roomIDs = Buildings[q.Building]
+	}
+	if len(roomIDs) == 0 {
+		return nil, fmt.Errorf("no room to search")
+	}
+	if len(q.Windows) == 0 {
+		return nil, fmt.Errorf("no time window to search")
+	}
+	if q.Concurrency <= 0 {
+		q.Concurrency = 3
+	}
+	if q.Interval <= 0 {
+		q.Interval = 500 * time.Millisecond
+	}
+
+	type task struct {
+		roomID string
+		window Period
+	}
+	tasks := make(chan task)
+	go func() {
+		defer close(tasks)
+		for _, window := range q.Windows {
+			for _, roomID := range roomIDs {
+				select {
+				case tasks <- task{roomID: roomID, window: window}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	// 所有 worker 共用一个节拍，控制整体请求频率
+	ticker := time.NewTicker(q.Interval)
+	defer ticker.Stop()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		report = &SearchReport{}
+		total  = len(q.Windows) * len(roomIDs)
+	)
+	for i := 0; i < q.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+
+				results, err := s.searchOne(ctx, stuID, t.roomID, t.window, q)
+				mu.Lock()
+				if err != nil {
+					report.Failures = append(report.Failures, fmt.Errorf("room %s %s: %w", t.roomID, formatPeriod(t.window), err))
+				} else {
+					report.Results = append(report.Results, results...)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	if len(report.Failures) == total {
+		return report, fmt.Errorf("all %d queries failed, first error: %w", total, report.Failures[0])
+	}
+
+	sortSearchResults(report.Results)
+	return report, nil
+}
+
+func (s *searcher) searchOne(ctx context.Context, stuID, roomID string, window Period, q SearchQuery) ([]SearchResult, error) {
+	seats, err := s.r.GetSeatsByTime(ctx, stuID, roomID, window.StartTime, window.EndTime, false, q.Filters...)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, seat := range seats {
+		free, periods := seat.IsFree(window.StartTime, window.EndTime)
+		if q.MinDuration <= 0 {
+			if free {
+				results = append(results, SearchResult{Seat: seat, Window: window, Free: periods[0]})
+			}
+			continue
+		}
+
+		var longest Period
+		for _, p := range periods {
+			if p.Duration() > longest.Duration() {
+				longest = p
+			}
+		}
+		if longest.Duration() >= q.MinDuration {
+			results = append(results, SearchResult{Seat: seat, Window: window, Free: longest})
+		}
+	}
+	return results, nil
+}
+
+func sortSearchResults(results []SearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Free.Duration() != b.Free.Duration() {
+			return a.Free.Duration() > b.Free.Duration()
+		}
+		if !a.Free.StartTime.Equal(b.Free.StartTime) {
+			return a.Free.StartTime.Before(b.Free.StartTime)
+		}
+		if a.Seat.RoomID != b.Seat.RoomID {
+			return a.Seat.RoomID < b.Seat.RoomID
+		}
+		return seatNameLess(a.Seat.SeatName, b.Seat.SeatName)
+	})
+}
+
+func formatPeriod(p Period) string {
+	return p.StartTime.Format("2006-01-02 15:04") + "-" + p.EndTime.Format("15:04")
+}
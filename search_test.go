@@ -0,0 +1,127 @@
+package library_reservation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+func TestSearch(t *testing.T) {
+	day1 := Period{StartTime: pkg.CreateShanghaiTime(2025, 6, 2, 14, 0), EndTime: pkg.CreateShanghaiTime(2025, 6, 2, 20, 0)}
+	day2 := Period{StartTime: pkg.CreateShanghaiTime(2025, 6, 3, 14, 0), EndTime: pkg.CreateShanghaiTime(2025, 6, 3, 20, 0)}
+
+	r := &fakeReverser{seats: func(int) []Seat {
+		return []Seat{
+			// 整段空闲
+			NewSeat("1", "N1-001", "room", "room", day1.StartTime, day1.EndTime, true, nil),
+			// 只有 2 小时空闲
+			NewSeat("2", "N1-002", "room", "room", day1.StartTime, day1.EndTime, false,
+				[]Period{{StartTime: day1.StartTime, EndTime: day1.StartTime.Add(4 * time.Hour)}}),
+		}
+	}}
+
+	report, err := NewSearcher(r).Search(context.Background(), "stu", SearchQuery{
+		RoomIDs:     []string{"a", "b"},
+		Windows:     []Period{day1, day2},
+		MinDuration: 2 * time.Hour,
+		Interval:    time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(report.Failures) != 0 {
+		t.Fatalf("unexpected failures %v", report.Failures)
+	}
+	// 第二天的时间段不在座位的预定时间段内，因此只有第一天的 2 个区域 × 2 个座位
+	if len(report.Results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(report.Results))
+	}
+	if first, last := report.Results[0], report.Results[3]; first.Seat.SeatID != "1" || last.Seat.SeatID != "2" ||
+		first.Free.Duration() != 6*time.Hour || last.Free.Duration() != 2*time.Hour {
+		t.Errorf("results are not ranked by free duration: %+v", report.Results)
+	}
+
+	if _, err := NewSearcher(r).Search(context.Background(), "stu", SearchQuery{Building: "不存在", Windows: []Period{day1}}); err == nil {
+		t.Errorf("expected error for unknown building")
+	}
+}
+
+func TestFindFreeBlocks(t *testing.T) {
+	outer := Period{StartTime: pkg.CreateShanghaiTime(2025, 6, 2, 8, 0), EndTime: pkg.CreateShanghaiTime(2025, 6, 2, 22, 0)}
+	at := func(h int) time.Time { return pkg.CreateShanghaiTime(2025, 6, 2, h, 0) }
+
+	seats := []Seat{
+		// 空闲: 8-10, 12-18
+		NewSeat("1", "N1-001", "room", "room", outer.StartTime, outer.EndTime, false,
+			[]Period{{StartTime: at(10), EndTime: at(12)}, {StartTime: at(18), EndTime: at(22)}}),
+		// 空闲: 9-11
+		NewSeat("2", "N1-002", "room", "room", outer.StartTime, outer.EndTime, false,
+			[]Period{{StartTime: at(8), EndTime: at(9)}, {StartTime: at(11), EndTime: at(22)}}),
+		// 空闲: 20:30-22，不足 2 小时
+		NewSeat("3", "N1-003", "room", "room", outer.StartTime, outer.EndTime, false,
+			[]Period{{StartTime: at(8), EndTime: at(20).Add(30 * time.Minute)}}),
+	}
+
+	blocks := FindFreeBlocks(seats, outer, 2*time.Hour, 4*time.Hour)
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 seats, got %+v", blocks)
+	}
+	first := blocks[0]
+	if first.Seat.SeatID != "1" || !first.Earliest.StartTime.Equal(at(8)) || !first.Earliest.EndTime.Equal(at(10)) {
+		t.Errorf("unexpected earliest block %+v", first)
+	}
+	// 12-18 被截断为 4 小时
+	if !first.Longest.StartTime.Equal(at(12)) || first.Longest.Duration() != 4*time.Hour {
+		t.Errorf("unexpected longest block %+v", first.Longest)
+	}
+	if blocks[1].Seat.SeatID != "2" || blocks[1].Longest.Duration() != 2*time.Hour {
+		t.Errorf("unexpected second seat %+v", blocks[1])
+	}
+}
+
+func TestSearchFlexible(t *testing.T) {
+	outer := Period{StartTime: pkg.CreateShanghaiTime(2025, 6, 2, 8, 0), EndTime: pkg.CreateShanghaiTime(2025, 6, 2, 22, 0)}
+	at := func(h int) time.Time { return pkg.CreateShanghaiTime(2025, 6, 2, h, 0) }
+
+	r := &fakeReverser{seats: func(int) []Seat {
+		return []Seat{
+			// 空闲: 14-22
+			NewSeat("1", "N1-001", "room", "room", outer.StartTime, outer.EndTime, false,
+				[]Period{{StartTime: at(8), EndTime: at(14)}}),
+			// 空闲: 8-9，不足 2 小时
+			NewSeat("2", "N1-002", "room", "room", outer.StartTime, outer.EndTime, false,
+				[]Period{{StartTime: at(9), EndTime: at(22)}}),
+		}
+	}}
+	s := NewSearcher(r)
+	ctx := context.Background()
+
+	blocks, err := s.SearchFlexible(ctx, "stu", "room", FlexibleQuery{Outer: outer, MinDuration: 2 * time.Hour, MaxDuration: 3 * time.Hour})
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(blocks) != 1 || blocks[0].Seat.SeatID != "1" {
+		t.Fatalf("expected only seat 1, got %+v", blocks)
+	}
+	if b := blocks[0].Longest; !b.StartTime.Equal(at(14)) || b.Duration() != 3*time.Hour {
+		t.Errorf("longest block should be capped to 3 hours from 14:00, got %+v", b)
+	}
+	if r.polls != 1 {
+		t.Errorf("expected one query, got %d", r.polls)
+	}
+
+	invalid := []FlexibleQuery{
+		{Outer: Period{StartTime: at(12), EndTime: at(10)}, MinDuration: time.Hour},
+		{Outer: outer, MinDuration: 3 * time.Hour, MaxDuration: time.Hour},
+	}
+	for _, q := range invalid {
+		if _, err := s.SearchFlexible(ctx, "stu", "room", q); err == nil {
+			t.Errorf("expected error for %+v", q)
+		}
+	}
+	if r.polls != 1 {
+		t.Errorf("invalid queries should not be sent, got %d queries", r.polls)
+	}
+}
@@ -0,0 +1,180 @@
+package library_reservation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+// DeviceStatus 座位设备状态
+type DeviceStatus int
+
+const (
+	DeviceUnknown      DeviceStatus = iota // 未知，devsta 的取值没有确认过
+	DeviceNormal                           // 正常
+	DeviceMaintenance                      // 维护中
+	DeviceOutOfService                     // 停用
+)
+
+func (s DeviceStatus) String() string {
+	switch s {
+	case DeviceNormal:
+		return "正常"
+	case DeviceMaintenance:
+		return "维护中"
+	case DeviceOutOfService:
+		return "停用"
+	default:
+		return "未知"
+	}
+}
+
+// SeatDetails 座位的完整信息，来自 device.aspx 的返回
+type SeatDetails struct {
+	BuildingID   int    // 楼宇ID
+	BuildingName string // 楼宇名称，例如 "南湖分馆"
+	Campus       string // 校区
+	LabID        string
+	LabName      string
+	KindID       string // 座位类型ID
+	KindName     string // 座位类型名称
+	ClassID      string
+	ClassName    string
+
+	Status    DeviceStatus // 设备状态
+	DevSta    int          // 原始的 devsta
+	RunSta    int          // 原始的 runsta
+	IsLong    bool         // 是否为长期座位
+	AllowLong bool         // 是否允许长期预约
+
+	MinMinutes  int      // 单次预约最短时长（分钟）
+	MaxMinutes  int      // 单次预约最长时长（分钟）
+	OpenStart   string   // 开放开始时间，例如 "08:00"
+	OpenEnd     string   // 开放结束时间，例如 "22:00"
+	Open        []string // 原始的开放时间
+	OpenPeriods []Period // 预定时间段内的开放时间段
+}
+
+// deviceStatusOf 只映射确认过的 devsta：可以正常预约的座位为 1。维护、停用对应的取值还没有确认，
+// 其它值一律作为 DeviceUnknown，可以通过 WithDeviceStatusMapping 自行映射
+func deviceStatusOf(devsta int) DeviceStatus {
+	switch devsta {
+	case 1:
+		return DeviceNormal
+	default:
+		return DeviceUnknown
+	}
+}
+
+// detailsFromCraw 从接口返回的座位数据中提取完整信息，无法解析的开放时间段作为 ParseWarning 返回
+func detailsFromCraw(info crawSeatInfo, window Period) (SeatDetails, []error) {
+	d := SeatDetails{
+		BuildingID:   info.BuildingID,
+		BuildingName: info.BuildingName,
+		Campus:       info.Campus,
+		LabID:        info.LabID,
+		LabName:      info.LabName,
+		KindID:       info.KindID,
+		KindName:     info.KindName,
+		ClassID:      info.ClassID,
+		ClassName:    info.ClassName,
+		Status:       deviceStatusOf(info.Devsta),
+		DevSta:       info.Devsta,
+		RunSta:       info.Runsta,
+		IsLong:       info.Islong,
+		AllowLong:    info.AllowLong,
+		MinMinutes:   info.Min,
+		MaxMinutes:   info.Max,
+		OpenStart:    info.OpenStart,
+		OpenEnd:      info.OpenEnd,
+		Open:         info.Open,
+	}
+
+	var warnings []error
+	for _, op := range info.Ops {
+		startTime, err1 := pkg.TransferStringToTime(op.Start, pkg.FORMAT2)
+		endTime, err2 := pkg.TransferStringToTime(op.End, pkg.FORMAT2)
+		if err1 != nil || err2 != nil {
+			warnings = append(warnings, &ParseWarning{SeatID: info.DevID, Start: op.Start, End: op.End,
+				Err: fmt.Errorf("malformed open period")})
+			continue
+		}
+		if p, ok := Intersect(Period{StartTime: startTime, EndTime: endTime}, window); ok {
+			d.OpenPeriods = append(d.OpenPeriods, p)
+		}
+	}
+	d.OpenPeriods = Merge(d.OpenPeriods)
+	return d, warnings
+}
+
+// SeatFilter 筛选座位，返回 false 的座位会被过滤掉
+type SeatFilter func(Seat) bool
+
+// InService 过滤掉维护中和停用的座位，状态未知的座位会被保留。
+// 默认的映射不会得到维护中和停用，需要通过 WithDeviceStatusMapping 配置
+func InService() SeatFilter {
+	return func(s Seat) bool {
+		return s.Details.Status != DeviceMaintenance && s.Details.Status != DeviceOutOfService
+	}
+}
+
+// AllowLongTerm 只保留允许长期预约的座位
+func AllowLongTerm() SeatFilter {
+	return func(s Seat) bool {
+		return s.Details.AllowLong
+	}
+}
+
+// InBuilding 只保留指定楼宇的座位
+func InBuilding(name string) SeatFilter {
+	return func(s Seat) bool {
+		return s.Details.BuildingName == name
+	}
+}
+
+// InCampus 只保留指定校区的座位
+func InCampus(campus string) SeatFilter {
+	return func(s Seat) bool {
+		return s.Details.Campus == campus
+	}
+}
+
+// OfKind 只保留指定类型的座位
+func OfKind(kindName string) SeatFilter {
+	return func(s Seat) bool {
+		return s.Details.KindName == kindName
+	}
+}
+
+// OfClass 只保留指定类别的座位
+func OfClass(className string) SeatFilter {
+	return func(s Seat) bool {
+		return s.Details.ClassName == className
+	}
+}
+
+// OpenDuring 只保留在 [startTime, endTime] 内全程开放的座位，没有开放时间信息的座位视为开放
+func OpenDuring(startTime, endTime time.Time) SeatFilter {
+	want := Period{StartTime: startTime, EndTime: endTime}
+	return func(s Seat) bool {
+		if len(s.Details.OpenPeriods) == 0 {
+			return true
+		}
+		for _, p := range s.Details.OpenPeriods {
+			if p.Contains(want) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func matchFilters(s Seat, filters []SeatFilter) bool {
+	for _, f := range filters {
+		if !f(s) {
+			return false
+		}
+	}
+	return true
+}
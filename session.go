@@ -0,0 +1,266 @@
+package library_reservation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session 学生在图书馆系统的登录会话
+type Session struct {
+	StuID       string
+	Jar         http.CookieJar // 登录过程中设置的所有 cookie，包括重定向中设置的
+	LoginAt     time.Time      // 登录或导入会话的时间
+	DisplayName string         // 图书馆系统中显示的姓名，只在设置了 WithDisplayName 时获取，失败或外部会话时为空
+	External    bool           // 是否是通过 StoreSession 或 ImportCookies 提供的会话
+
+	base   *url.URL // 图书馆系统的地址
+	cookie string   // GetCookie 返回的 Cookie 请求头
+}
+
+// Cookies 返回会话中发送给图书馆系统的 cookie
+func (s *Session) Cookies() []*http.Cookie {
+	if s.Jar == nil || s.base == nil {
+		return nil
+	}
+	return s.Jar.Cookies(s.base)
+}
+
+// externalSession 通过 StoreSession 或 ImportCookies 保存的、在浏览器中登录得到的会话
+type externalSession struct {
+	session *Session
+	expired bool // 图书馆系统提示未登录后置为 true
+}
+
+// StoreSession 保存在浏览器中登录后得到的 cookie，之后 GetSession 直接返回它而不再用密码登录。
+// cookie 可以是 ASP.NET_SessionId 的值，也可以是完整的 Cookie 请求头，例如 "ASP.NET_SessionId=xxx; JSESSIONID=yyy"
+func (a *auther) StoreSession(ctx context.Context, stuID, cookie string) error {
+	cookie = strings.TrimSpace(cookie)
+	if cookie == "" {
+		return fmt.Errorf("empty cookie")
+	}
+	if !strings.Contains(cookie, "=") {
+		cookie = CookieKey1 + "=" + cookie
+	}
+	cookies, err := http.ParseCookie(cookie)
+	if err != nil {
+		return fmt.Errorf("invalid cookie: %w", err)
+	}
+
+	base := a.opts.kjyyBase()
+	jar, _ := cookiejar.New(nil)
+	jar.SetCookies(base, cookies)
+	sess := &Session{
+		StuID:    stuID,
+		Jar:      jar,
+		LoginAt:  time.Now(),
+		External: true,
+		base:     base,
+		cookie:   cookie,
+	}
+
+	a.sessionMutex.Lock()
+	defer a.sessionMutex.Unlock()
+
+	if a.external == nil {
+		a.external = make(map[string]*externalSession)
+	}
+	a.external[stuID] = &externalSession{session: sess}
+	delete(a.sessions, stuID)
+	return nil
+}
+
+// ImportCookies 从浏览器导出的 Netscape 格式 cookies.txt 中导入图书馆系统域名下的 cookie，效果同 StoreSession
+func (a *auther) ImportCookies(ctx context.Context, stuID string, r io.Reader) error {
+	cookies, err := ParseCookiesTxt(r)
+	if err != nil {
+		return err
+	}
+
+	host := a.opts.kjyyBase().Hostname()
+	var (
+		parts      []string
+		hasSession bool
+	)
+	for _, c := range cookies {
+		if !domainMatch(host, c.Domain) {
+			continue
+		}
+		if c.Name == CookieKey1 {
+			hasSession = true
+		}
+		parts = append(parts, c.Name+"="+c.Value)
+	}
+	if !hasSession {
+		return fmt.Errorf("no %s cookie for %s found", CookieKey1, host)
+	}
+	return a.StoreSession(ctx, stuID, strings.Join(parts, "; "))
+}
+
+// Invalidate 通知 Auther 该学生的会话已经失效。用密码登录的学生下次 GetSession 会重新登录；
+// 外部会话会被标记为过期，如果没有保存密码，返回 ErrSessionExpired，之后 GetSession 也返回 ErrSessionExpired
+func (a *auther) Invalidate(ctx context.Context, stuID string) error {
+	a.sessionMutex.Lock()
+	delete(a.sessions, stuID)
+	s, exists := a.external[stuID]
+	expired := exists && !s.expired
+	if expired {
+		s.expired = true
+	}
+	a.sessionMutex.Unlock()
+
+	a.infoMutex.RLock()
+	_, hasPwd := a.stuInfo[stuID]
+	a.infoMutex.RUnlock()
+
+	if expired {
+		a.opts.notify(ctx, Notification{Kind: NotifyLoginFailure, StuID: stuID, Err: ErrSessionExpired.Error()})
+	}
+	if exists && !hasPwd {
+		return fmt.Errorf("%w: %s", ErrSessionExpired, stuID)
+	}
+	return nil
+}
+
+// kjyyBase 图书馆系统的地址，用于从 cookie jar 中取出发送给它的 cookie
+func (o *options) kjyyBase() *url.URL {
+	u, err := url.Parse(o.kjyyURL)
+	if err != nil {
+		return &url.URL{}
+	}
+	return u
+}
+
+// ParseCookiesTxt 解析 Netscape 格式的 cookies.txt，每行依次为 domain、includeSubdomains、path、secure、
+// expires、name、value，以 Tab 分隔。已经过期的 cookie 会被忽略
+func ParseCookiesTxt(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	now := time.Now()
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		httpOnly := false
+		// curl 等工具用 #HttpOnly_ 前缀标记 HttpOnly 的 cookie
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, httpOnly = rest, true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("cookies.txt line %d: expected 7 fields, got %d", lineNo, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cookies.txt line %d: invalid expires %q", lineNo, fields[4])
+		}
+
+		c := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		// expires 为 0 表示会话 cookie
+		if expires != 0 {
+			c.Expires = time.Unix(expires, 0)
+			if c.Expires.Before(now) {
+				continue
+			}
+		}
+		cookies = append(cookies, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cookies.txt: %w", err)
+	}
+	return cookies, nil
+}
+
+// domainMatch 判断 cookie 的 domain 是否适用于 host
+func domainMatch(host, domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	host = strings.ToLower(host)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// 图书馆系统提示需要登录的文字
+var sessionExpiredMessages = []string{"未登录", "请登录", "请先登录", "重新登录", "登录超时", "登录已过期", "会话过期"}
+
+// isSessionExpired 判断图书馆系统的响应是否表示 cookie 已失效：
+// 接口返回了 HTML 页面（被重定向到登录页）而不是 JSON，或者 msg 提示需要登录
+func isSessionExpired(body []byte, msg string) bool {
+	for _, m := range sessionExpiredMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	head := bytes.ToLower(bytes.TrimSpace(body))
+	return bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.HasPrefix(head, []byte("<html"))
+}
+
+// expireSession 图书馆系统提示未登录时通知 Auther，并丢弃学生的 http.Client。
+// 外部会话无法重新登录时返回 ErrSessionExpired，否则返回可以重试的 ErrLoggedOut
+func (r *reverser) expireSession(ctx context.Context, stuID string) error {
+	r.clientMu.Lock()
+	delete(r.clients, stuID)
+	r.clientMu.Unlock()
+
+	if sp, ok := r.au.(SessionProvider); ok {
+		if err := sp.Invalidate(ctx, stuID); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrLoggedOut, stuID)
+}
+
+// session 返回学生的会话。Auther 没有实现 SessionProvider，或者会话中没有 cookie jar 时，
+// 使用 GetCookie 返回的 cookie
+func (r *reverser) session(ctx context.Context, stuID string) (*Session, error) {
+	if sp, ok := r.au.(SessionProvider); ok {
+		sess, err := sp.GetSession(ctx, stuID)
+		if err != nil || sess.Jar != nil || sess.cookie != "" {
+			return sess, err
+		}
+	}
+	cookie, err := r.au.GetCookie(ctx, stuID)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{StuID: stuID, cookie: cookie}, nil
+}
+
+// do 用学生的会话发送请求：会话有 cookie jar 时使用学生专用的 http.Client，否则把 cookie 放在请求头中
+func (r *reverser) do(stuID string, sess *Session, ep Endpoint, req *http.Request) (*http.Response, error) {
+	if sess.Jar == nil {
+		req.Header.Set("Cookie", sess.cookie)
+		return r.opts.do(r.cli, stuID, ep, req)
+	}
+	return r.opts.do(r.clientFor(stuID, sess), stuID, ep, req)
+}
+
+// clientFor 返回学生专用的 http.Client，它使用会话的 cookie jar，所有学生共享同一个 Transport。
+// 会话更新（重新登录或重新导入）后创建新的 http.Client
+func (r *reverser) clientFor(stuID string, sess *Session) *http.Client {
+	r.clientMu.Lock()
+	defer r.clientMu.Unlock()
+
+	if cli, ok := r.clients[stuID]; ok && cli.Jar == sess.Jar {
+		return cli
+	}
+	cli := &http.Client{Transport: r.transport, Jar: sess.Jar}
+	r.clients[stuID] = cli
+	return cli
+}
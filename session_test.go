@@ -0,0 +1,306 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseCookiesTxt(t *testing.T) {
+	txt := strings.Join([]string{
+		"# Netscape HTTP Cookie File",
+		"",
+		"kjyy.ccnu.edu.cn\tFALSE\t/\tFALSE\t0\tASP.NET_SessionId\tsid",
+		"#HttpOnly_.ccnu.edu.cn\tTRUE\t/\tTRUE\t4102444800\tJSESSIONID\tjsid",
+		"kjyy.ccnu.edu.cn\tFALSE\t/\tFALSE\t1\told\texpired",
+	}, "\n")
+
+	cookies, err := ParseCookiesTxt(strings.NewReader(txt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 2 {
+		t.Fatalf("expected 2 cookies, got %d", len(cookies))
+	}
+	if c := cookies[0]; c.Name != CookieKey1 || c.Value != "sid" || !c.Expires.IsZero() {
+		t.Errorf("unexpected cookie %+v", c)
+	}
+	if c := cookies[1]; c.Domain != ".ccnu.edu.cn" || !c.HttpOnly || !c.Secure || c.Value != "jsid" {
+		t.Errorf("unexpected cookie %+v", c)
+	}
+
+	if _, err := ParseCookiesTxt(strings.NewReader("kjyy.ccnu.edu.cn\tFALSE\t/")); err == nil {
+		t.Error("expected error for malformed line")
+	}
+}
+
+func TestImportCookies(t *testing.T) {
+	a := NewAuther(WithBaseURLs("http://kjyy.ccnu.edu.cn", DefaultCASBaseURL))
+	store := a.(SessionStore)
+	ctx := context.Background()
+
+	txt := "kjyy.ccnu.edu.cn\tFALSE\t/\tFALSE\t0\tASP.NET_SessionId\tsid\n" +
+		".ccnu.edu.cn\tTRUE\t/\tFALSE\t0\tJSESSIONID\tjsid\n" +
+		"account.ccnu.edu.cn\tFALSE\t/\tFALSE\t0\tCASTGC\ttgc\n"
+	if err := store.ImportCookies(ctx, "2023000001", strings.NewReader(txt)); err != nil {
+		t.Fatal(err)
+	}
+	cookie, err := a.GetCookie(ctx, "2023000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookie != "ASP.NET_SessionId=sid; JSESSIONID=jsid" {
+		t.Errorf("unexpected cookie %q", cookie)
+	}
+
+	if err := store.ImportCookies(ctx, "2023000002", strings.NewReader("account.ccnu.edu.cn\tFALSE\t/\tFALSE\t0\tCASTGC\ttgc\n")); err == nil {
+		t.Error("expected error without ASP.NET_SessionId")
+	}
+
+	if err := store.StoreSession(ctx, "2023000003", "raw"); err != nil {
+		t.Fatal(err)
+	}
+	if cookie, _ := a.GetCookie(ctx, "2023000003"); cookie != CookieKey1+"=raw" {
+		t.Errorf("unexpected cookie %q", cookie)
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	var logins atomic.Int32
+	srv := newFakeCAS(t, func(w http.ResponseWriter, r *http.Request) {
+		logins.Add(1)
+		http.Redirect(w, r, "/loginall.aspx", http.StatusFound)
+	})
+	// 外部会话失效后，图书馆系统把 ajax 请求重定向到登录页
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ClientWeb/pro/ajax/device.aspx", func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Cookie"), "stale") {
+			fmt.Fprint(w, "<!DOCTYPE html><html><body>统一身份认证</body></html>")
+			return
+		}
+		fmt.Fprint(w, `{"ret":1,"data":[]}`)
+	})
+	mux.Handle("/", srv.Config.Handler)
+	srv.Config.Handler = mux
+
+	notifier := &recordNotifier{}
+	a := newTestAuther(srv, WithNotifier(notifier))
+	ctx := context.Background()
+	_ = a.(SessionStore).StoreSession(ctx, "2023000002", "stale")
+	_ = a.(SessionStore).StoreSession(ctx, "2023000001", "stale")
+
+	r := NewReverser(a,
+		WithBaseURLs(srv.URL, srv.URL+"/cas"),
+		WithLimiter(NewLimiter(LimiterConfig{})),
+		WithBreaker(NewBreaker(BreakerConfig{})),
+		WithRetryPolicy(fastRetry),
+	)
+	start := time.Now().Add(time.Hour)
+
+	// 只有外部会话的学生不会尝试用密码登录
+	if _, err := r.GetSeatsByTime(ctx, "2023000002", "101", start, start.Add(time.Hour), false); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("expected ErrSessionExpired, got %v", err)
+	}
+	if _, err := a.GetCookie(ctx, "2023000002"); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("expected ErrSessionExpired from GetCookie, got %v", err)
+	}
+	if n := notifier.got; len(n) != 1 || n[0].Kind != NotifyLoginFailure {
+		t.Errorf("expected one login failure notification, got %+v", n)
+	}
+
+	// 同时保存了密码的学生在会话失效后改用密码登录，重试后成功
+	if _, err := r.GetSeatsByTime(ctx, "2023000001", "101", start, start.Add(time.Hour), false); err != nil {
+		t.Fatalf("expected password login after session expired, got %v", err)
+	}
+	if logins.Load() != 1 {
+		t.Errorf("expected 1 password login, got %d", logins.Load())
+	}
+}
+
+func TestIsSessionExpired(t *testing.T) {
+	cases := []struct {
+		body string
+		msg  string
+		want bool
+	}{
+		{`{"ret":0,"msg":"该时间段已被预约"}`, "该时间段已被预约", false},
+		{`{"ret":-1,"msg":"未登录或登录超时"}`, "未登录或登录超时", true},
+		{"\n<html><head><title>统一身份认证</title></head></html>", "", true},
+		{"not json", "", false},
+	}
+	for _, c := range cases {
+		if got := isSessionExpired([]byte(c.body), c.msg); got != c.want {
+			t.Errorf("isSessionExpired(%q, %q) = %v, want %v", c.body, c.msg, got, c.want)
+		}
+	}
+}
+
+func TestSessionCookieJar(t *testing.T) {
+	srv := newFakeCAS(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loginall.aspx?page=", http.StatusFound)
+	})
+	var gotCookie atomic.Value
+	mux := http.NewServeMux()
+	// 重定向链中设置的 cookie 也要带上
+	mux.HandleFunc("/loginall.aspx", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "ic2_user", Value: "u1", Path: "/"})
+	})
+	mux.HandleFunc("/ClientWeb/pro/ajax/login.aspx", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ret":1,"data":{"name":"张三"}}`)
+	})
+	mux.HandleFunc("/ClientWeb/pro/ajax/device.aspx", func(w http.ResponseWriter, r *http.Request) {
+		gotCookie.Store(r.Header.Get("Cookie"))
+		fmt.Fprint(w, `{"ret":1,"data":[]}`)
+	})
+	mux.Handle("/", srv.Config.Handler)
+	srv.Config.Handler = mux
+
+	a := newTestAuther(srv, WithDisplayName())
+	ctx := context.Background()
+	sess, err := a.(SessionProvider).GetSession(ctx, "2023000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.DisplayName != "张三" || sess.External || sess.LoginAt.IsZero() {
+		t.Errorf("unexpected session %+v", sess)
+	}
+	names := make(map[string]string)
+	for _, c := range sess.Cookies() {
+		names[c.Name] = c.Value
+	}
+	if names[CookieKey1] != "sid" || names["ic2_user"] != "u1" {
+		t.Errorf("expected session and redirect cookies in jar, got %v", names)
+	}
+	if cookie, _ := a.GetCookie(ctx, "2023000001"); cookie != CookieKey1+"=sid" {
+		t.Errorf("GetCookie should stay compatible, got %q", cookie)
+	}
+
+	r := NewReverser(a,
+		WithBaseURLs(srv.URL, srv.URL+"/cas"),
+		WithLimiter(NewLimiter(LimiterConfig{})),
+		WithBreaker(NewBreaker(BreakerConfig{})),
+	)
+	start := time.Now().Add(time.Hour)
+	if _, err := r.GetSeatsByTime(ctx, "2023000001", "101", start, start.Add(time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+	if cookie, _ := gotCookie.Load().(string); !strings.Contains(cookie, "ic2_user=u1") || !strings.Contains(cookie, CookieKey1+"=sid") {
+		t.Errorf("expected all session cookies to be sent, got %q", cookie)
+	}
+}
+
+func TestDisplayNameOptional(t *testing.T) {
+	srv := newFakeCAS(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loginall.aspx?page=", http.StatusFound)
+	})
+	var userInfo atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/loginall.aspx", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/ClientWeb/pro/ajax/login.aspx", func(w http.ResponseWriter, r *http.Request) {
+		userInfo.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.Handle("/", srv.Config.Handler)
+	srv.Config.Handler = mux
+	ctx := context.Background()
+
+	// 默认不获取姓名
+	if _, err := newTestAuther(srv).(SessionProvider).GetSession(ctx, "2023000001"); err != nil {
+		t.Fatal(err)
+	}
+	if n := userInfo.Load(); n != 0 {
+		t.Errorf("display name should not be fetched by default, got %d requests", n)
+	}
+
+	// 获取姓名失败不影响登录，也不计入熔断
+	br := NewBreaker(BreakerConfig{FailureThreshold: 1})
+	sess, err := newTestAuther(srv, WithDisplayName(), WithBreaker(br)).(SessionProvider).GetSession(ctx, "2023000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userInfo.Load() != 1 || sess.DisplayName != "" {
+		t.Errorf("expected one failed display name request, got %d requests and name %q", userInfo.Load(), sess.DisplayName)
+	}
+	if st := br.State(ServiceKJYY); st != BreakerClosed {
+		t.Errorf("display name failure should not trip the breaker, got %v", st)
+	}
+}
+
+func TestPasswordSessionLoggedOut(t *testing.T) {
+	var logins, devices atomic.Int32
+	srv := newFakeCAS(t, func(w http.ResponseWriter, r *http.Request) {
+		logins.Add(1)
+		http.Redirect(w, r, "/loginall.aspx", http.StatusFound)
+	})
+	mux := http.NewServeMux()
+	// 第一次请求时服务端注销了会话
+	mux.HandleFunc("/ClientWeb/pro/ajax/device.aspx", func(w http.ResponseWriter, r *http.Request) {
+		if devices.Add(1) == 1 {
+			fmt.Fprint(w, `{"ret":-1,"msg":"未登录或登录超时"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ret":1,"data":[]}`)
+	})
+	mux.Handle("/", srv.Config.Handler)
+	srv.Config.Handler = mux
+
+	a := newTestAuther(srv)
+	start := time.Now().Add(time.Hour)
+	newReverser := func(policy RetryPolicy) Reverser {
+		return NewReverser(a,
+			WithBaseURLs(srv.URL, srv.URL+"/cas"),
+			WithLimiter(NewLimiter(LimiterConfig{})),
+			WithBreaker(NewBreaker(BreakerConfig{})),
+			WithRetryPolicy(policy),
+		)
+	}
+
+	// 用密码登录的学生重新登录后重试，不返回 ErrSessionExpired
+	if _, err := newReverser(fastRetry).GetSeatsByTime(context.Background(), "2023000001", "101", start, start.Add(time.Hour), false); err != nil {
+		t.Fatalf("expected retry after re-login to succeed, got %v", err)
+	}
+	if n := logins.Load(); n != 2 {
+		t.Errorf("expected a second login after logout, got %d logins", n)
+	}
+
+	// 不重试时返回可以重试的 ErrLoggedOut
+	devices.Store(0)
+	_, err := newReverser(NoRetry()).GetSeatsByTime(context.Background(), "2023000001", "101", start, start.Add(time.Hour), false)
+	if !errors.Is(err, ErrLoggedOut) || errors.Is(err, ErrSessionExpired) || !IsRetryable(err) {
+		t.Errorf("expected retryable ErrLoggedOut, got %v", err)
+	}
+}
+
+func TestSessionCookieHeader(t *testing.T) {
+	var got atomic.Value
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got.Store(req.Header.Get("Cookie"))
+		fmt.Fprint(w, `{"ret":1,"data":[]}`)
+	})
+	start := time.Now().Add(time.Hour)
+
+	// 会话有 cookie jar 时通过 jar 发送
+	r := newTestReverser(t, handler)
+	if _, err := r.GetSeatsByTime(context.Background(), "a", "101", start, start.Add(time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+	if cookie, _ := got.Load().(string); cookie != CookieKey1+"=test" {
+		t.Errorf("expected cookie from jar, got %q", cookie)
+	}
+
+	// 只实现了 Auther 时使用 GetCookie 返回的 cookie
+	got.Store("")
+	r = newTestReverser(t, handler)
+	r.au = struct{ Auther }{r.au}
+	if _, err := r.GetSeatsByTime(context.Background(), "a", "101", start, start.Add(time.Hour), false); err != nil {
+		t.Fatal(err)
+	}
+	if cookie, _ := got.Load().(string); cookie != CookieKey1+"=test" {
+		t.Errorf("expected cookie from GetCookie, got %q", cookie)
+	}
+}
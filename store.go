@@ -0,0 +1,99 @@
+package library_reservation
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// OccupancyRecord 某次快照中一个座位的占用情况
+type OccupancyRecord struct {
+	At          time.Time `json:"at"` // 快照时间
+	RoomID      string    `json:"roomId"`
+	RoomName    string    `json:"roomName"`
+	SeatID      string    `json:"seatId"`
+	SeatName    string    `json:"seatName"`
+	WindowStart time.Time `json:"windowStart"` // 查询的时间段
+	WindowEnd   time.Time `json:"windowEnd"`
+	Free        bool      `json:"free"`               // 在查询时间段内是否整段空闲
+	Occupied    []Period  `json:"occupied,omitempty"` // 占用时间段，Owner 已匿名化
+}
+
+type OccupancyStore interface {
+	Append(ctx context.Context, records []OccupancyRecord) error
+	// Scan 按写入顺序遍历所有记录，fn 返回错误时停止遍历
+	Scan(ctx context.Context, fn func(OccupancyRecord) error) error
+}
+
+// jsonlStore 以 JSON Lines 格式追加写入本地文件
+type jsonlStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewJSONLStore(path string) OccupancyStore {
+	return &jsonlStore{path: path}
+}
+
+func (s *jsonlStore) Append(ctx context.Context, records []OccupancyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open store: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return fmt.Errorf("failed to encode record: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	return f.Sync()
+}
+
+func (s *jsonlStore) Scan(ctx context.Context, fn func(OccupancyRecord) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open store: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var rec OccupancyRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return fmt.Errorf("failed to decode record at line %d: %w", line, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
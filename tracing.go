@@ -0,0 +1,195 @@
+package library_reservation
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Attribute span 的属性，键名尽量沿用 OpenTelemetry 的语义约定
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span 一次操作或一次 HTTP 请求，方法与 OpenTelemetry 的 trace.Span 对应，便于适配
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Tracer 创建 span 的接口，可以用 OpenTelemetry 的 Tracer 实现。
+// 返回的 ctx 中带有新的 span，之后用该 ctx 创建的 span 是它的子 span
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...Attribute) {}
+func (nopSpan) RecordError(error)          {}
+func (nopSpan) End()                       {}
+
+// 各个操作的 span 名称
+const (
+	SpanGetCookie        = "auther.GetCookie"
+	SpanGetNecessaryInfo = "auther.getNecessaryInfo"
+	SpanLogin            = "auther.login"
+	SpanGetSeats         = "reverser.getSeats"
+	SpanReverse          = "reverser.Reverse"
+	SpanReverseAttempt   = "reverser.reverse"
+	SpanGetReservations  = "reverser.getReservations"
+)
+
+// startSpan 开始一个操作的 span，设置了盐时学号以加盐哈希的形式记录
+func (o *options) startSpan(ctx context.Context, name, stuID string, attrs ...Attribute) (context.Context, Span) {
+	if stuID != "" && o.traceSalt != "" {
+		attrs = append(attrs, Attr("student.hash", AnonymizeOwner(o.traceSalt, stuID)))
+	}
+	return o.tracer.Start(ctx, name, attrs...)
+}
+
+// endSpan 记录错误并结束 span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// tracingTransport 为每一次 HTTP 请求创建 span，重定向的每一跳都会单独记录
+type tracingTransport struct {
+	base   http.RoundTripper
+	tracer Tracer
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, span := t.tracer.Start(req.Context(), "HTTP "+req.Method+" "+req.URL.Host+req.URL.Path,
+		Attr("http.method", req.Method),
+		Attr("http.host", req.URL.Host),
+		Attr("http.path", req.URL.Path),
+	)
+	defer span.End()
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(Attr("http.status_code", resp.StatusCode))
+	if loc := resp.Header.Get("Location"); loc != "" {
+		span.SetAttributes(Attr("http.redirect", loc))
+	}
+	return resp, nil
+}
+
+// transport 在 base 外面包上 tracing
+func (o *options) transport(base http.RoundTripper) http.RoundTripper {
+	if _, ok := o.tracer.(nopTracer); ok {
+		return base
+	}
+	return &tracingTransport{base: base, tracer: o.tracer}
+}
+
+// RecordedSpan SpanRecorder 记录的 span
+type RecordedSpan struct {
+	ID         uint64
+	ParentID   uint64 // 0 表示根 span
+	Name       string
+	Attributes map[string]any
+	Errors     []error
+	StartTime  time.Time
+	EndTime    time.Time
+}
+
+// SpanRecorder 把结束的 span 保存在内存中的 Tracer，用于测试和调试
+type SpanRecorder interface {
+	Tracer
+	// Spans 返回已经结束的 span，按结束顺序排列
+	Spans() []RecordedSpan
+}
+
+type spanRecorder struct {
+	mu     sync.Mutex
+	nextID atomic.Uint64
+	spans  []RecordedSpan
+}
+
+func NewSpanRecorder() SpanRecorder {
+	return &spanRecorder{}
+}
+
+type recordedSpanKey struct{}
+
+func (r *spanRecorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	s := &recordingSpan{
+		recorder: r,
+		data: RecordedSpan{
+			ID:         r.nextID.Add(1),
+			Name:       name,
+			Attributes: make(map[string]any),
+			StartTime:  time.Now(),
+		},
+	}
+	if parent, ok := ctx.Value(recordedSpanKey{}).(*recordingSpan); ok {
+		s.data.ParentID = parent.data.ID
+	}
+	s.SetAttributes(attrs...)
+	return context.WithValue(ctx, recordedSpanKey{}, s), s
+}
+
+func (r *spanRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedSpan(nil), r.spans...)
+}
+
+type recordingSpan struct {
+	mu       sync.Mutex
+	recorder *spanRecorder
+	data     RecordedSpan
+	ended    bool
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range attrs {
+		s.data.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Errors = append(s.data.Errors, err)
+}
+
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.recorder.mu.Lock()
+	s.recorder.spans = append(s.recorder.spans, data)
+	s.recorder.mu.Unlock()
+}
@@ -0,0 +1,105 @@
+package library_reservation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+func TestTracingSpans(t *testing.T) {
+	rec := NewSpanRecorder()
+	r := newTestReverser(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.Contains(req.URL.Path, "reserve.aspx"):
+			fmt.Fprint(w, `{"ret":0,"msg":"该时间段已被预约"}`)
+		default:
+			fmt.Fprint(w, `{"ret":1,"msg":""}`)
+		}
+	}), WithTracer(rec, "salt"), WithRetryPolicy(NoRetry()))
+
+	if _, err := r.GetReservations(context.Background(), "2023000001"); err != nil {
+		t.Fatal(err)
+	}
+	start := pkg.CreateShanghaiTime(2025, 6, 2, 14, 0)
+	_ = r.Reverse(context.Background(), "2023000001", "101", start, start.Add(time.Hour))
+
+	byName := make(map[string]RecordedSpan)
+	for _, s := range rec.Spans() {
+		byName[s.Name] = s
+	}
+
+	res, ok := byName[SpanGetReservations]
+	if !ok {
+		t.Fatalf("missing %s span in %+v", SpanGetReservations, rec.Spans())
+	}
+	if res.Attributes["student.hash"] != AnonymizeOwner("salt", "2023000001") || res.Attributes["library.ret"] != 1 {
+		t.Errorf("unexpected attributes %v", res.Attributes)
+	}
+	var httpSpan *RecordedSpan
+	for _, s := range rec.Spans() {
+		if s.ParentID == res.ID && strings.HasPrefix(s.Name, "HTTP GET") {
+			httpSpan = &s
+		}
+	}
+	if httpSpan == nil || httpSpan.Attributes["http.status_code"] != http.StatusOK {
+		t.Errorf("expected an HTTP child span of %s, got %+v", SpanGetReservations, rec.Spans())
+	}
+
+	outer, attempt := byName[SpanReverse], byName[SpanReverseAttempt]
+	if attempt.ParentID != outer.ID || outer.ID == 0 {
+		t.Errorf("attempt span should be a child of %s", SpanReverse)
+	}
+	if attempt.Attributes["library.ret"] != 0 || attempt.Attributes["seat.id"] != "101" || len(outer.Errors) != 1 {
+		t.Errorf("unexpected reverse spans %+v %+v", outer, attempt)
+	}
+}
+
+func TestTracingRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/login" {
+			http.Redirect(w, req, "/home", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	rec := NewSpanRecorder()
+	cli := &http.Client{Transport: &tracingTransport{base: http.DefaultTransport, tracer: rec}}
+	resp, err := cli.Get(srv.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	spans := rec.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected one span per hop, got %+v", spans)
+	}
+	if spans[0].Attributes["http.status_code"] != http.StatusFound || spans[0].Attributes["http.redirect"] != "/home" {
+		t.Errorf("unexpected first hop %+v", spans[0])
+	}
+	if spans[1].Attributes["http.path"] != "/home" {
+		t.Errorf("unexpected second hop %+v", spans[1])
+	}
+}
+
+func TestTracingWithoutSalt(t *testing.T) {
+	rec := NewSpanRecorder()
+	r := newTestReverser(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"ret":1,"msg":""}`)
+	}), WithTracer(rec, ""), WithRetryPolicy(NoRetry()))
+
+	if _, err := r.GetReservations(context.Background(), "2023000001"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range rec.Spans() {
+		if _, ok := s.Attributes["student.hash"]; ok {
+			t.Errorf("student.hash should not be recorded without a salt, got %v in %s", s.Attributes, s.Name)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrWaitlistDeadline 到达截止时间仍未预约成功
+	ErrWaitlistDeadline = errors.New("waitlist deadline exceeded")
+	// ErrWaitlistCancelled 请求被取消，或同一学生的其他请求已经预约成功
+	ErrWaitlistCancelled = errors.New("waitlist request cancelled")
+)
+
+// WaitlistRequest 候补预约请求
+type WaitlistRequest struct {
+	StuID     string
+	RoomIDs   []string
+	StartTime time.Time
+	EndTime   time.Time
+	// Priority 团队成员之间的优先级，数值越小越先尝试预约
+	Priority int
+	// Deadline 超过该时间仍未预约成功则放弃，零值表示预约开始时间
+	Deadline time.Time
+	// Prefer 座位偏好，返回 false 的座位不会被预约，nil 表示任意座位
+	Prefer func(Seat) bool
+}
+
+// WaitlistResult 候补请求的最终结果，Err 为 nil 表示已预约到 Seat
+type WaitlistResult struct {
+	Request WaitlistRequest
+	Seat    Seat
+	Err     error
+}
+
+type Waitlist interface {
+	// Add 将请求加入对应学生的候补队列，同一学生的多个请求按加入顺序排队，
+	// 任意一个预约成功后其余请求都会被取消
+	Add(req WaitlistRequest) error
+	// Cancel 取消某个学生的全部候补请求
+	Cancel(stuID string)
+	// Run 开始监控并在座位空出时自动预约，所有请求都有结果后返回本次运行中产生的结果。
+	// 返回后队列被清空，可以重新 Add 后再次 Run
+	Run(ctx context.Context) []WaitlistResult
+}
+
+type waitEntry struct {
+	seq     int
+	req     WaitlistRequest
+	done    bool
+	lastErr error
+}
+
+type waitlist struct {
+	r Reverser
+	w Watcher
+	// 预约失败的请求每隔一个轮询间隔对仍然空闲的座位重试一次
+	retryInterval time.Duration
+
+	mu      sync.Mutex
+	seq     int
+	running bool
+	queues  map[string][]*waitEntry // stuID -> 按加入顺序排列的请求
+	results []WaitlistResult
+
+	// 同一时刻只发出一个预约请求，避免同一学生在多个区域同时预约成功
+	bookMu sync.Mutex
+}
+
+// NewWaitlist 创建候补预约，opts 用于配置内部使用的 Watcher
+func NewWaitlist(r Reverser, opts ...WatcherOption) Waitlist {
+	opts = append(opts, WithInitialEvents())
+	w := NewWatcher(r, opts...).(*watcher)
+	return &waitlist{
+		r:             r,
+		w:             w,
+		retryInterval: w.interval,
+		queues:        make(map[string][]*waitEntry),
+	}
+}
+
+func (wl *waitlist) Add(req WaitlistRequest) error {
+	if req.StuID == "" || len(req.RoomIDs) == 0 {
+		return fmt.Errorf("stuID and roomIDs are required")
+	}
+	if !req.StartTime.Before(req.EndTime) {
+		return fmt.Errorf("invalid time range: %v - %v", req.StartTime, req.EndTime)
+	}
+	if req.Deadline.IsZero() {
+		req.Deadline = req.StartTime
+	}
+
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	if wl.running {
+		return fmt.Errorf("waitlist is already running")
+	}
+	wl.seq++
+	wl.queues[req.StuID] = append(wl.queues[req.StuID], &waitEntry{seq: wl.seq, req: req})
+	return nil
+}
+
+func (wl *waitlist) Cancel(stuID string) {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	for _, e := range wl.queues[stuID] {
+		wl.resolveLocked(e, Seat{}, ErrWaitlistCancelled)
+	}
+}
+
+func (wl *waitlist) Run(ctx context.Context) []WaitlistResult {
+	wl.mu.Lock()
+	wl.running = true
+	// 相同时间段的请求共用一个 Watcher
+	groups := make(map[[2]int64][]*waitEntry)
+	for _, queue := range wl.queues {
+		for _, e := range queue {
+			if e.done {
+				continue
+			}
+			key := [2]int64{e.req.StartTime.Unix(), e.req.EndTime.Unix()}
+			groups[key] = append(groups[key], e)
+		}
+	}
+	wl.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, entries := range groups {
+		wg.Add(1)
+		go func(entries []*waitEntry) {
+			defer wg.Done()
+			wl.runGroup(ctx, entries)
+		}(entries)
+	}
+	wg.Wait()
+
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	for _, queue := range wl.queues {
+		for _, e := range queue {
+			wl.resolveLocked(e, Seat{}, ctx.Err())
+		}
+	}
+	results := wl.results
+	wl.results = nil
+	wl.queues = make(map[string][]*waitEntry)
+	wl.running = false
+	return results
+}
+
+func (wl *waitlist) runGroup(ctx context.Context, entries []*waitEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entryLess(entries[i], entries[j])
+	})
+
+	var (
+		rooms    []string
+		seen     = make(map[string]bool)
+		deadline time.Time
+	)
+	for _, e := range entries {
+		for _, roomID := range e.req.RoomIDs {
+			if !seen[roomID] {
+				seen[roomID] = true
+				rooms = append(rooms, roomID)
+			}
+		}
+		if e.req.Deadline.After(deadline) {
+			deadline = e.req.Deadline
+		}
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	defer func() {
+		wl.expire(entries, time.Now())
+	}()
+
+	startTime, endTime := entries[0].req.StartTime, entries[0].req.EndTime
+	// 查询座位使用优先级最高的学生的登录状态
+	events := wl.w.Watch(ctx, entries[0].req.StuID, rooms, startTime, endTime)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	retry := time.NewTicker(wl.retryInterval)
+	defer retry.Stop()
+
+	// 当前空闲的座位。Watcher 只在状态变化时发出事件，预约失败后座位仍然空闲时不会再收到事件，
+	// 所以记下空闲的座位，之后定期为还没有结果的请求重试
+	free := make(map[string]SeatEvent)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			key := ev.RoomID + "/" + ev.Seat.SeatID
+			switch ev.Type {
+			case SeatFreed:
+				free[key] = ev
+				if wl.tryBook(ctx, entries, ev.RoomID, ev.Seat) {
+					delete(free, key)
+				}
+			case SeatTaken:
+				delete(free, key)
+			}
+		case <-retry.C:
+			keys := make([]string, 0, len(free))
+			for key := range free {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if wl.allDone(entries) {
+					break
+				}
+				if ev := free[key]; wl.tryBook(ctx, entries, ev.RoomID, ev.Seat) {
+					delete(free, key)
+				}
+			}
+		case now := <-ticker.C:
+			wl.expire(entries, now)
+		}
+		if wl.allDone(entries) {
+			return
+		}
+	}
+}
+
+// tryBook 按优先级依次为匹配的请求预约该座位，直到有一个成功。预约失败的请求保持等待，返回是否预约成功
+func (wl *waitlist) tryBook(ctx context.Context, entries []*waitEntry, roomID string, seat Seat) bool {
+	wl.bookMu.Lock()
+	defer wl.bookMu.Unlock()
+
+	for _, e := range entries {
+		wl.mu.Lock()
+		match := !e.done && slices.Contains(e.req.RoomIDs, roomID) && (e.req.Prefer == nil || e.req.Prefer(seat))
+		wl.mu.Unlock()
+		if !match {
+			continue
+		}
+
+		err := wl.r.Reverse(ctx, e.req.StuID, seat.SeatID, e.req.StartTime, e.req.EndTime)
+
+		wl.mu.Lock()
+		if err != nil {
+			e.lastErr = err
+			wl.mu.Unlock()
+			continue
+		}
+		wl.resolveLocked(e, seat, nil)
+		for _, other := range wl.queues[e.req.StuID] {
+			wl.resolveLocked(other, Seat{}, ErrWaitlistCancelled)
+		}
+		wl.mu.Unlock()
+		return true
+	}
+	return false
+}
+
+func (wl *waitlist) expire(entries []*waitEntry, now time.Time) {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	for _, e := range entries {
+		if e.done || now.Before(e.req.Deadline) {
+			continue
+		}
+		err := ErrWaitlistDeadline
+		if e.lastErr != nil {
+			err = fmt.Errorf("%w, last error: %v", ErrWaitlistDeadline, e.lastErr)
+		}
+		wl.resolveLocked(e, Seat{}, err)
+	}
+}
+
+func (wl *waitlist) allDone(entries []*waitEntry) bool {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	for _, e := range entries {
+		if !e.done {
+			return false
+		}
+	}
+	return true
+}
+
+func (wl *waitlist) resolveLocked(e *waitEntry, seat Seat, err error) {
+	if e.done {
+		return
+	}
+	if err == nil && seat.SeatID == "" {
+		err = ErrWaitlistCancelled
+	}
+	e.done = true
+	wl.results = append(wl.results, WaitlistResult{Request: e.req, Seat: seat, Err: err})
+}
+
+func entryLess(a, b *waitEntry) bool {
+	if a.req.Priority != b.req.Priority {
+		return a.req.Priority < b.req.Priority
+	}
+	return a.seq < b.seq
+}
@@ -0,0 +1,133 @@
+package library_reservation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeReverser struct {
+	mu       sync.Mutex
+	polls    int
+	seats    func(poll int) []Seat
+	reserved map[string]string // seatID -> stuID
+}
+
+func (f *fakeReverser) GetSeatsByTime(ctx context.Context, stuID, roomID string, startTime, endTime time.Time, onlyAvailable bool, filters ...SeatFilter) ([]Seat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.polls++
+	return f.seats(f.polls), nil
+}
+
+func (f *fakeReverser) Reverse(ctx context.Context, stuID, seatID string, startTime, endTime time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.reserved == nil {
+		f.reserved = make(map[string]string)
+	}
+	if _, ok := f.reserved[seatID]; ok {
+		return fmt.Errorf("%w: seat already reserved", ErrReverseRejected)
+	}
+	f.reserved[seatID] = stuID
+	return nil
+}
+
+func (f *fakeReverser) GetReservations(ctx context.Context, stuID string) ([]Reservation, error) {
+	return nil, nil
+}
+
+func TestWaitlistPriority(t *testing.T) {
+	start := time.Now().Add(time.Hour)
+	end := start.Add(2 * time.Hour)
+
+	r := &fakeReverser{seats: func(poll int) []Seat {
+		// 第三次轮询时座位被释放
+		free := poll >= 3
+		var occ []Period
+		if !free {
+			occ = []Period{{StartTime: start, EndTime: end}}
+		}
+		return []Seat{NewSeat("1", "N1-001", "room", "room", start, end, free, occ)}
+	}}
+
+	wl := NewWaitlist(r, WithPollInterval(10*time.Millisecond), WithPollJitter(0))
+	requests := []WaitlistRequest{
+		{StuID: "low", RoomIDs: []string{"room"}, StartTime: start, EndTime: end, Priority: 2, Deadline: time.Now().Add(time.Second)},
+		{StuID: "high", RoomIDs: []string{"room"}, StartTime: start, EndTime: end, Priority: 1, Deadline: time.Now().Add(time.Second)},
+	}
+	for _, req := range requests {
+		if err := wl.Add(req); err != nil {
+			t.Fatalf("failed to add request: %v", err)
+		}
+	}
+
+	results := wl.Run(context.Background())
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	for _, res := range results {
+		switch res.Request.StuID {
+		case "high":
+			if res.Err != nil || res.Seat.SeatID != "1" {
+				t.Errorf("high priority student should get seat 1, got %+v", res)
+			}
+		case "low":
+			if !errors.Is(res.Err, ErrWaitlistDeadline) {
+				t.Errorf("low priority student should hit deadline, got %v", res.Err)
+			}
+		}
+	}
+}
+
+// flakyReverser 前 fails 次预约失败
+type flakyReverser struct {
+	*fakeReverser
+	fails int
+}
+
+func (f *flakyReverser) Reverse(ctx context.Context, stuID, seatID string, startTime, endTime time.Time) error {
+	f.mu.Lock()
+	if f.fails > 0 {
+		f.fails--
+		f.mu.Unlock()
+		return errors.New("network error")
+	}
+	f.mu.Unlock()
+	return f.fakeReverser.Reverse(ctx, stuID, seatID, startTime, endTime)
+}
+
+func TestWaitlistRetryFailedBooking(t *testing.T) {
+	start := time.Now().Add(time.Hour)
+	end := start.Add(2 * time.Hour)
+
+	// 座位一直空闲，Watcher 只会发出一次 SeatFreed
+	r := &flakyReverser{fakeReverser: &fakeReverser{seats: func(int) []Seat {
+		return []Seat{NewSeat("1", "N1-001", "room", "room", start, end, true, nil)}
+	}}, fails: 1}
+
+	wl := NewWaitlist(r, WithPollInterval(10*time.Millisecond), WithPollJitter(0))
+	add := func(stuID string) {
+		err := wl.Add(WaitlistRequest{StuID: stuID, RoomIDs: []string{"room"}, StartTime: start, EndTime: end, Deadline: time.Now().Add(time.Second)})
+		if err != nil {
+			t.Fatalf("failed to add request: %v", err)
+		}
+	}
+
+	add("a")
+	results := wl.Run(context.Background())
+	if len(results) != 1 || results[0].Err != nil || results[0].Seat.SeatID != "1" {
+		t.Fatalf("failed booking should be retried on a still free seat, got %+v", results)
+	}
+
+	// 第二次 Run 只返回本次的结果
+	r.reserved = nil
+	add("b")
+	results = wl.Run(context.Background())
+	if len(results) != 1 || results[0].Request.StuID != "b" {
+		t.Errorf("expected only the result of the second run, got %+v", results)
+	}
+}
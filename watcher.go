@@ -0,0 +1,245 @@
+package library_reservation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SeatEventType 座位变化事件的类型
+type SeatEventType int
+
+const (
+	// SeatFreed 座位在整个预定时间段内变为空闲
+	SeatFreed SeatEventType = iota + 1
+	// SeatTaken 原本整段空闲的座位被占用
+	SeatTaken
+	// PeriodOpened 座位仍未整段空闲，但出现了新的空闲时间段
+	PeriodOpened
+)
+
+func (t SeatEventType) String() string {
+	switch t {
+	case SeatFreed:
+		return "SeatFreed"
+	case SeatTaken:
+		return "SeatTaken"
+	case PeriodOpened:
+		return "PeriodOpened"
+	default:
+		return fmt.Sprintf("SeatEventType(%d)", int(t))
+	}
+}
+
+// SeatEvent 两次轮询之间座位状态的变化
+type SeatEvent struct {
+	Type   SeatEventType
+	RoomID string
+	Seat   Seat      // 最新一次轮询得到的座位信息
+	Opened []Period  // 新出现的空闲时间段，仅 PeriodOpened 时有值
+	At     time.Time // 发现变化的时间
+}
+
+type Watcher interface {
+	// Watch 轮询 roomIDs 中每个区域在 [startTime, endTime] 内的座位，
+	// 比较前后两次快照并把变化通过 channel 发出，ctx 结束后 channel 关闭
+	Watch(ctx context.Context, stuID string, roomIDs []string, startTime, endTime time.Time) <-chan SeatEvent
+}
+
+type WatcherOption func(*watcher)
+
+// WithPollInterval 设置轮询间隔，默认 1 分钟
+func WithPollInterval(d time.Duration) WatcherOption {
+	return func(w *watcher) {
+		if d > 0 {
+			w.interval = d
+		}
+	}
+}
+
+// WithPollJitter 设置轮询间隔的随机抖动比例（0~1），默认 0.2，
+// 避免多个区域或多个进程在同一时刻请求
+func WithPollJitter(frac float64) WatcherOption {
+	return func(w *watcher) {
+		if frac >= 0 && frac <= 1 {
+			w.jitter = frac
+		}
+	}
+}
+
+// WithMaxBackoff 设置请求失败后退避的最大间隔，默认 10 分钟
+func WithMaxBackoff(d time.Duration) WatcherOption {
+	return func(w *watcher) {
+		if d > 0 {
+			w.maxBackoff = d
+		}
+	}
+}
+
+// WithInitialEvents 第一次轮询时把已经整段空闲的座位作为 SeatFreed 事件发出
+func WithInitialEvents() WatcherOption {
+	return func(w *watcher) {
+		w.initialEvents = true
+	}
+}
+
+// WithWatchErrorHandler 设置轮询失败时的回调，默认用 log 输出到标准错误
+func WithWatchErrorHandler(fn func(roomID string, err error)) WatcherOption {
+	return func(w *watcher) {
+		if fn != nil {
+			w.onError = fn
+		}
+	}
+}
+
+type watcher struct {
+	r Reverser
+
+	interval      time.Duration
+	jitter        float64
+	maxBackoff    time.Duration
+	initialEvents bool
+	onError       func(roomID string, err error)
+}
+
+func NewWatcher(r Reverser, opts ...WatcherOption) Watcher {
+	w := &watcher{
+		r:          r,
+		interval:   time.Minute,
+		jitter:     0.2,
+		maxBackoff: 10 * time.Minute,
+		onError: func(roomID string, err error) {
+			log.Printf("watch room %s failed: %v", roomID, err)
+		},
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+func (w *watcher) Watch(ctx context.Context, stuID string, roomIDs []string, startTime, endTime time.Time) <-chan SeatEvent {
+	events := make(chan SeatEvent, 64)
+
+	var wg sync.WaitGroup
+	for _, roomID := range roomIDs {
+		wg.Add(1)
+		go func(roomID string) {
+			defer wg.Done()
+			w.watchRoom(ctx, stuID, roomID, startTime, endTime, events)
+		}(roomID)
+	}
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	return events
+}
+
+func (w *watcher) watchRoom(ctx context.Context, stuID, roomID string, startTime, endTime time.Time, events chan<- SeatEvent) {
+	var (
+		prev    map[string]Seat
+		backoff time.Duration
+	)
+
+	for {
+		seats, err := w.r.GetSeatsByTime(ctx, stuID, roomID, startTime, endTime, false)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			w.onError(roomID, err)
+			// 失败后指数退避，减轻对图书馆系统的压力
+			if backoff == 0 {
+				backoff = w.interval
+			} else {
+				backoff *= 2
+			}
+			if backoff > w.maxBackoff {
+				backoff = w.maxBackoff
+			}
+			if !sleepCtx(ctx, w.withJitter(backoff)) {
+				return
+			}
+			continue
+		}
+		backoff = 0
+
+		curr := make(map[string]Seat, len(seats))
+		for _, seat := range seats {
+			curr[seat.SeatID] = seat
+		}
+
+		if prev != nil || w.initialEvents {
+			for _, ev := range diffSeats(prev, curr, startTime, endTime) {
+				ev.RoomID = roomID
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+		prev = curr
+
+		if !sleepCtx(ctx, w.withJitter(w.interval)) {
+			return
+		}
+	}
+}
+
+func (w *watcher) withJitter(d time.Duration) time.Duration {
+	if w.jitter == 0 {
+		return d
+	}
+	delta := time.Duration((rand.Float64()*2 - 1) * w.jitter * float64(d))
+	return d + delta
+}
+
+// diffSeats 比较两次快照，prev 为 nil 时视为所有座位此前都被占用
+func diffSeats(prev, curr map[string]Seat, startTime, endTime time.Time) []SeatEvent {
+	var events []SeatEvent
+	now := time.Now()
+
+	for id, seat := range curr {
+		nowFree, nowPeriods := seat.IsFree(startTime, endTime)
+
+		old, existed := prev[id]
+		if !existed {
+			if nowFree {
+				events = append(events, SeatEvent{Type: SeatFreed, Seat: seat, At: now})
+			}
+			continue
+		}
+		oldFree, oldPeriods := old.IsFree(startTime, endTime)
+
+		switch {
+		case !oldFree && nowFree:
+			events = append(events, SeatEvent{Type: SeatFreed, Seat: seat, At: now})
+		case oldFree && !nowFree:
+			events = append(events, SeatEvent{Type: SeatTaken, Seat: seat, At: now})
+		case !nowFree:
+			if opened := Subtract(nowPeriods, oldPeriods); len(opened) > 0 {
+				events = append(events, SeatEvent{Type: PeriodOpened, Seat: seat, Opened: opened, At: now})
+			}
+		}
+	}
+	return events
+}
+
+// sleepCtx 等待 d，ctx 先结束时返回 false
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,53 @@
+package library_reservation
+
+import (
+	"testing"
+
+	"github.com/chencheng8888/ccnu-library-reservations/pkg"
+)
+
+func TestDiffSeats(t *testing.T) {
+	start := pkg.CreateShanghaiTime(2025, 6, 1, 8, 0)
+	end := pkg.CreateShanghaiTime(2025, 6, 1, 22, 0)
+	at := func(h, m int) Period {
+		return Period{StartTime: pkg.CreateShanghaiTime(2025, 6, 1, h, m)}
+	}
+	period := func(sh, sm, eh, em int) Period {
+		return Period{StartTime: at(sh, sm).StartTime, EndTime: at(eh, em).StartTime}
+	}
+
+	prev := map[string]Seat{
+		"1": NewSeat("1", "N1-001", "r", "room", start, end, false, []Period{period(8, 0, 22, 0)}),
+		"2": NewSeat("2", "N1-002", "r", "room", start, end, true, nil),
+		"3": NewSeat("3", "N1-003", "r", "room", start, end, false, []Period{period(8, 0, 22, 0)}),
+		"4": NewSeat("4", "N1-004", "r", "room", start, end, false, []Period{period(10, 0, 12, 0)}),
+	}
+	curr := map[string]Seat{
+		"1": NewSeat("1", "N1-001", "r", "room", start, end, true, nil),
+		"2": NewSeat("2", "N1-002", "r", "room", start, end, false, []Period{period(9, 0, 10, 0)}),
+		"3": NewSeat("3", "N1-003", "r", "room", start, end, false, []Period{period(8, 0, 14, 0)}),
+		"4": NewSeat("4", "N1-004", "r", "room", start, end, false, []Period{period(10, 0, 12, 0)}),
+	}
+
+	events := diffSeats(prev, curr, start, end)
+	got := make(map[string]SeatEvent)
+	for _, ev := range events {
+		got[ev.Seat.SeatID] = ev
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 events, got %d: %+v", len(got), events)
+	}
+	if got["1"].Type != SeatFreed {
+		t.Errorf("seat 1: expected SeatFreed, got %v", got["1"].Type)
+	}
+	if got["2"].Type != SeatTaken {
+		t.Errorf("seat 2: expected SeatTaken, got %v", got["2"].Type)
+	}
+	ev := got["3"]
+	if ev.Type != PeriodOpened {
+		t.Fatalf("seat 3: expected PeriodOpened, got %v", ev.Type)
+	}
+	if len(ev.Opened) != 1 || !ev.Opened[0].StartTime.Equal(at(14, 0).StartTime) || !ev.Opened[0].EndTime.Equal(end) {
+		t.Errorf("seat 3: unexpected opened periods %+v", ev.Opened)
+	}
+}